@@ -0,0 +1,108 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the optional YAML configuration file, eg:
+//
+//	resampled:
+//	  patterns:
+//	    - '(?i)__(FocusFillMax|Webp)([a-z0-9_]*)\.[a-z0-9]{1,4}$'
+//	  exceptions:
+//	    - '__FitMaxWzM1MiwyNjRd\.'
+//	hooks:
+//	  pre-load:
+//	    - 'touch maintenance.flag'
+//	  post-load:
+//	    - 'rm maintenance.flag'
+type Config struct {
+	Resampled struct {
+		// Patterns are additional regular expressions matching resampled images
+		Patterns []string `yaml:"patterns"`
+
+		// Exceptions are regular expressions matching files that are never resampled images
+		Exceptions []string `yaml:"exceptions"`
+	} `yaml:"resampled"`
+
+	// Hooks are shell commands run before & after operations
+	Hooks HookCommands `yaml:"hooks"`
+}
+
+// HookCommands are the shell commands run before & after a save or load
+type HookCommands struct {
+	// PreSave commands are run before a save, which is aborted if any fail
+	PreSave []string `yaml:"pre-save"`
+
+	// PostSave commands are run after a successful save
+	PostSave []string `yaml:"post-save"`
+
+	// PreLoad commands are run before a load, which is aborted if any fail
+	PreLoad []string `yaml:"pre-load"`
+
+	// PostLoad commands are run after a successful load
+	PostLoad []string `yaml:"post-load"`
+
+	// OnError commands are run when a save or load fails
+	OnError []string `yaml:"on-error"`
+}
+
+// DefaultConfigFile returns the path of the default configuration file,
+// eg: ~/.config/ssbak/config.yml
+func DefaultConfigFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+
+	return filepath.Join(dir, "ssbak", "config.yml")
+}
+
+// LoadConfig reads the YAML configuration file and applies its settings
+func LoadConfig(file string) error {
+	data, err := os.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return fmt.Errorf("error reading config: %s", err.Error())
+	}
+
+	var c Config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return fmt.Errorf("error parsing config '%s': %s", file, err.Error())
+	}
+
+	Log(fmt.Sprintf("Loaded config '%s'", file))
+
+	Hooks.PreSave = append(Hooks.PreSave, c.Hooks.PreSave...)
+	Hooks.PostSave = append(Hooks.PostSave, c.Hooks.PostSave...)
+	Hooks.PreLoad = append(Hooks.PreLoad, c.Hooks.PreLoad...)
+	Hooks.PostLoad = append(Hooks.PostLoad, c.Hooks.PostLoad...)
+	Hooks.OnError = append(Hooks.OnError, c.Hooks.OnError...)
+
+	return AddResampledPatterns(c.Resampled.Patterns, c.Resampled.Exceptions)
+}
+
+// AddResampledPatterns adds regular expressions to ResampledRegex and ResampledExceptions
+func AddResampledPatterns(patterns, exceptions []string) error {
+	for _, p := range patterns {
+		r, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("invalid resampled pattern '%s': %s", p, err.Error())
+		}
+		ResampledRegex = append(ResampledRegex, r)
+	}
+
+	for _, p := range exceptions {
+		r, err := regexp.Compile(p)
+		if err != nil {
+			return fmt.Errorf("invalid resampled exception '%s': %s", p, err.Error())
+		}
+		ResampledExceptions = append(ResampledExceptions, r)
+	}
+
+	return nil
+}
@@ -21,6 +21,34 @@ type configFile struct {
 
 // BootstrapEnv sets up the Silverstripe environment
 func BootstrapEnv(dir string) error {
+	if err := LoadEnv(dir); err != nil {
+		return err
+	}
+
+	if DB.Name == "" {
+		if !dotEnvIgnored() {
+			fmt.Println("no .env file detected")
+		}
+		return errors.New("no database defined")
+	}
+
+	if DB.Username == "" {
+		return errors.New("no database user defined")
+	}
+
+	// MySQLPDODatabase, MySQLDatabase, MSSQLDatabase, PostgreSQLDatabase
+	if DB.Type == "" || strings.Contains(strings.ToLower(DB.Type), "mysql") {
+		DB.Type = "MySQL"
+	} else {
+		return fmt.Errorf("database %s not supported", DB.Type)
+	}
+
+	return nil
+}
+
+// LoadEnv sets ProjectRoot and parses the Silverstripe environment (.env or
+// _ss_environment.php) without requiring a database to be defined
+func LoadEnv(dir string) error {
 	if !isDir(dir) {
 		return fmt.Errorf("%s is not a directory", dir)
 	}
@@ -51,25 +79,24 @@ func BootstrapEnv(dir string) error {
 	// load/overwrite variables from environment if set
 	setFromEnv()
 
-	if DB.Name == "" {
-		if !dotEnvIgnored() {
-			fmt.Println("no .env file detected")
-		}
-		return errors.New("no database defined")
-	}
+	return nil
+}
 
-	if DB.Username == "" {
-		return errors.New("no database user defined")
+// CacheDir returns the Silverstripe cache directory of the project: TEMP_PATH if
+// set, otherwise the silverstripe-cache directory in the ProjectRoot if it exists.
+// It returns an empty string if neither is found. The default cache directory in
+// the system temporary directory depends on the PHP version and user, so it
+// cannot be detected.
+func CacheDir() string {
+	if TempPath != "" {
+		return TempPath
 	}
 
-	// MySQLPDODatabase, MySQLDatabase, MSSQLDatabase, PostgreSQLDatabase
-	if DB.Type == "" || strings.Contains(strings.ToLower(DB.Type), "mysql") {
-		DB.Type = "MySQL"
-	} else {
-		return fmt.Errorf("database %s not supported", DB.Type)
+	if dir := path.Join(ProjectRoot, "silverstripe-cache"); isDir(dir) {
+		return dir
 	}
 
-	return nil
+	return ""
 }
 
 // FindConfig will return a configuration file path & type if found
@@ -120,6 +147,18 @@ func setFromEnv() {
 	if v, ok := os.LookupEnv("SS_DATABASE_PORT"); ok {
 		DB.Port = v
 	}
+	if v, ok := os.LookupEnv("SS_PROTECTED_ASSETS_PATH"); ok {
+		ProtectedAssetsPath = v
+		if v != "" && !filepath.IsAbs(v) {
+			ProtectedAssetsPath = filepath.Join(ProjectRoot, v)
+		}
+	}
+	if v, ok := os.LookupEnv("TEMP_PATH"); ok {
+		TempPath = v
+		if v != "" && !filepath.IsAbs(v) {
+			TempPath = filepath.Join(ProjectRoot, v)
+		}
+	}
 
 	if DB.Name == "" && os.Getenv("SS_DATABASE_CHOOSE_NAME") != "" {
 		DB.Name = dbChooseName(os.Getenv("SS_DATABASE_CHOOSE_NAME"))
@@ -13,6 +13,13 @@ var (
 	// Verbose logging
 	Verbose bool
 
+	// ProtectedAssetsPath is the protected assets store set with SS_PROTECTED_ASSETS_PATH,
+	// or empty when protected assets are stored in assets/.protected
+	ProtectedAssetsPath string
+
+	// TempPath is the Silverstripe cache directory set with TEMP_PATH, or empty when not set
+	TempPath string
+
 	// TempFiles get cleaned up on exit
 	tempFiles []string
 
@@ -25,9 +32,39 @@ var (
 	// OnlyDB runtime variable set with flags
 	OnlyDB bool
 
+	// Tables runtime variable set with flags, limits a database restore to matching tables
+	Tables []string
+
+	// IntoTable runtime variable set with flags, restores the (single) matching table under this name
+	IntoTable string
+
+	// RewriteURLs runtime variable set with flags, `old=new` URLs replaced in the database on import
+	RewriteURLs []string
+
+	// KeepOldAssets runtime variable set with flags
+	KeepOldAssets bool
+
+	// Decompress runtime variable set with flags, extracts the database as plain SQL
+	Decompress bool
+
+	// Unpack runtime variable set with flags, extracts the assets as a directory
+	Unpack bool
+
 	// IgnoreResampled runtime variable set with flags
 	IgnoreResampled bool
 
+	// Includes runtime variable set with flags, limits the assets to files matching these gitignore-style patterns
+	Includes []string
+
+	// Excludes runtime variable set with flags, skips asset files matching these gitignore-style patterns
+	Excludes []string
+
+	// ExcludeLargerThan runtime variable set with flags, skips asset files larger than this (bytes, 0 for no limit)
+	ExcludeLargerThan int64
+
+	// Hooks are the shell commands run before & after operations, set in the config file
+	Hooks HookCommands
+
 	// ResampledRegex regular expressions should match all common thumbnail manipulations except for
 	// resized images as those tend to be linked from HTMLText and aren't auto-generated without a republish
 	ResampledRegex = []*regexp.Regexp{
@@ -37,6 +74,12 @@ var (
 		// Silverstripe 3
 		regexp.MustCompile(`(?i)\/\_resampled\/(Pad|CMSThumbnail|stripthumbnail|Cropped|Set|Fit|Fill|Scale|Resampled).*\.(jpg|png|jpeg|tiff)`),
 	}
+
+	// ResampledExceptions regular expressions match files that are never considered resampled images,
+	// eg: Silverstripe 5 generates thumbnails for CMS previews by default with `__FitMaxWzM1MiwyNjRd`
+	ResampledExceptions = []*regexp.Regexp{
+		regexp.MustCompile(`__FitMaxWzM1MiwyNjRd\.`),
+	}
 )
 
 // DBStruct struct
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/axllent/ssbak/internal/sspak"
+	"github.com/spf13/cobra"
+)
+
+// addCompressionFlags adds the flags to configure the compression of new archives
+func addCompressionFlags(cmd *cobra.Command) {
+	cmd.Flags().
+		StringP("compression", "c", string(sspak.CompressionGzip), "compression algorithm (gzip, zstd, xz or none)")
+
+	cmd.Flags().
+		String("assets-compression", "", "assets compression (gzip, zstd, xz, none or adaptive), default same as --compression")
+
+	cmd.Flags().
+		IntP("level", "l", 0, "compression level (gzip 1-9, zstd 1-22 in 4 steps: 1-2, 3-5, 6-9 & 10-22, xz 1-9 dictionary size), default if unset")
+
+	cmd.Flags().
+		Int("threads", 0, "number of threads used by zstd & parallel gzip compression (default all CPUs)")
+
+	cmd.Flags().
+		Bool("parallel-gzip", false, "use multi-threaded gzip compression")
+
+	cmd.Flags().
+		BoolP("zstd", "z", false, "use zstd compression (same as --compression zstd)")
+}
+
+// compressionFromFlags returns the compression options set by the flags
+func compressionFromFlags(cmd *cobra.Command) (sspak.CompressionOptions, error) {
+	name, _ := cmd.Flags().GetString("compression")
+	level, _ := cmd.Flags().GetInt("level")
+	threads, _ := cmd.Flags().GetInt("threads")
+	parallelGzip, _ := cmd.Flags().GetBool("parallel-gzip")
+	useZSTD, _ := cmd.Flags().GetBool("zstd")
+	assetsName, _ := cmd.Flags().GetString("assets-compression")
+
+	algorithm, err := sspak.ParseCompressionAlgorithm(name)
+	if err != nil {
+		return sspak.CompressionOptions{}, err
+	}
+
+	if useZSTD {
+		if cmd.Flags().Changed("compression") && algorithm != sspak.CompressionZSTD {
+			return sspak.CompressionOptions{}, errors.New("you cannot use --zstd with --compression " + name)
+		}
+		algorithm = sspak.CompressionZSTD
+	}
+
+	if parallelGzip && algorithm != sspak.CompressionGzip {
+		return sspak.CompressionOptions{}, errors.New("--parallel-gzip can only be used with gzip compression")
+	}
+
+	var assets sspak.CompressionAlgorithm
+	if assetsName != "" {
+		if assets, err = sspak.ParseAssetsCompressionAlgorithm(assetsName); err != nil {
+			return sspak.CompressionOptions{}, err
+		}
+	}
+
+	opts := sspak.CompressionOptions{
+		Algorithm:    algorithm,
+		Level:        level,
+		Concurrency:  threads,
+		ParallelGzip: parallelGzip,
+		Assets:       assets,
+	}
+
+	return opts, opts.Validate()
+}
@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/sspak"
+	"github.com/axllent/ssbak/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// convertCmd represents the convert command
+var convertCmd = &cobra.Command{
+	Use:   "convert <sspak> <output sspak>",
+	Short: "Recompress .sspak backup",
+	Long: `Convert an .sspak backup to a different compression format or level.
+
+Each file in the archive is streamed through decompression and recompression
+without extracting the archive. Resampled images can be dropped, and the database
+limited to specific tables, in the same pass.
+
+Note: zstd and uncompressed archives are not compatible with the legacy SSPak utility.`,
+	Example: `  ssbak convert website.sspak website-zstd.sspak --compression zstd --level 19
+  ssbak convert website-zstd.sspak website.sspak --compression gzip
+  ssbak convert website.sspak small.sspak --ignore-resampled --table 'SiteTree*'`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if !utils.IsFile(args[0]) {
+			return fmt.Errorf("'%s' does not exist", args[0])
+		}
+
+		compression, err := compressionFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+
+		return sspak.Convert(args[0], args[1], compression)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+
+	addCompressionFlags(convertCmd)
+
+	convertCmd.Flags().
+		BoolVarP(&app.IgnoreResampled, "ignore-resampled", "i", false, "drop most resampled images")
+
+	addResampledFlags(convertCmd)
+
+	convertCmd.Flags().
+		StringArrayVarP(&app.Tables, "table", "t", []string{}, "only keep the table(s) matching the name or pattern (repeatable)")
+
+	convertCmd.Flags().
+		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
+}
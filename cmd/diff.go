@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/sspak"
+	"github.com/axllent/ssbak/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// diffCmd represents the diff command
+var diffCmd = &cobra.Command{
+	Use:   "diff <sspak|webroot> <sspak|webroot>",
+	Short: "Compare .sspak backups or a live website",
+	Long: `Compare the assets and database of two .sspak backups, or of an .sspak backup
+and a live website (using the website's database settings).
+
+Reports the asset files that were added, removed or changed (by size and
+SHA-256 hash), and the database tables that were added, removed, or whose row
+count or schema changed.`,
+	Example: `  ssbak diff monday.sspak tuesday.sspak
+  ssbak diff monday.sspak tuesday.sspak --db
+  ssbak diff website.sspak ./`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if app.OnlyAssets && app.OnlyDB {
+			return errors.New("you cannot use --assets and --db flags together")
+		}
+
+		sizeOnly, _ := cmd.Flags().GetBool("size-only")
+
+		if utils.IsDir(args[0]) && utils.IsDir(args[1]) {
+			return errors.New("at least one of the arguments must be an .sspak backup")
+		}
+
+		snapshots := []*sspak.Snapshot{}
+		for _, arg := range args {
+			var snapshot *sspak.Snapshot
+			var err error
+
+			if utils.IsDir(arg) {
+				snapshot, err = liveSnapshot(arg, !sizeOnly)
+			} else {
+				snapshot, err = archiveSnapshot(arg, !sizeOnly)
+			}
+
+			if err != nil {
+				return err
+			}
+
+			snapshots = append(snapshots, snapshot)
+		}
+
+		printDiff(snapshots[0], snapshots[1])
+
+		return nil
+	},
+}
+
+// archiveSnapshot returns the snapshot of an .sspak backup
+func archiveSnapshot(file string, withHashes bool) (*sspak.Snapshot, error) {
+	if !utils.IsFile(file) {
+		return nil, fmt.Errorf("'%s' does not exist", file)
+	}
+
+	archive, err := sspak.Probe(file)
+	if err != nil {
+		return nil, err
+	}
+
+	return archive.Snapshot(withHashes)
+}
+
+// liveSnapshot returns the snapshot of the assets & database of the website in webroot
+func liveSnapshot(webroot string, withHashes bool) (*sspak.Snapshot, error) {
+	app.ProjectRoot = webroot
+
+	withDatabase := !app.OnlyAssets
+	if withDatabase {
+		if err := app.BootstrapEnv(webroot); err != nil {
+			return nil, err
+		}
+	}
+
+	assetsDir := path.Join(assetsBase(), "assets")
+
+	return sspak.LiveSnapshot(webroot, assetsDir, !app.OnlyDB, withDatabase, withHashes)
+}
+
+// printDiff prints the differences from snapshot a to snapshot b
+func printDiff(a, b *sspak.Snapshot) {
+	d := sspak.Compare(a, b)
+
+	fmt.Printf("--- %s\n+++ %s\n", a.Name, b.Name)
+
+	if a.HasAssets != b.HasAssets {
+		fmt.Printf("\nAssets: only in '%s'\n", onlyIn(a, b, a.HasAssets))
+	} else if a.HasAssets {
+		fmt.Printf("\nAssets: %d added, %d removed, %d changed\n", len(d.AssetsAdded), len(d.AssetsRemoved), len(d.AssetsChanged))
+		for _, name := range d.AssetsAdded {
+			fmt.Printf("  + %s (%s)\n", name, utils.ByteToHr(b.Assets[name].Size))
+		}
+		for _, name := range d.AssetsRemoved {
+			fmt.Printf("  - %s (%s)\n", name, utils.ByteToHr(a.Assets[name].Size))
+		}
+		for _, name := range d.AssetsChanged {
+			fmt.Printf("  ~ %s (%s -> %s)\n", name, utils.ByteToHr(a.Assets[name].Size), utils.ByteToHr(b.Assets[name].Size))
+		}
+	}
+
+	if a.HasDatabase != b.HasDatabase {
+		fmt.Printf("\nDatabase: only in '%s'\n", onlyIn(a, b, a.HasDatabase))
+	} else if a.HasDatabase {
+		fmt.Printf("\nDatabase: %d tables added, %d removed, %d changed\n", len(d.TablesAdded), len(d.TablesRemoved), len(d.TablesChanged))
+		for _, name := range d.TablesAdded {
+			fmt.Printf("  + %s (%d rows)\n", name, b.Tables[name].Rows)
+		}
+		for _, name := range d.TablesRemoved {
+			fmt.Printf("  - %s (%d rows)\n", name, a.Tables[name].Rows)
+		}
+		for _, name := range d.TablesChanged {
+			x, y := a.Tables[name], b.Tables[name]
+			changes := fmt.Sprintf("%d -> %d rows", x.Rows, y.Rows)
+			if x.Rows == y.Rows {
+				changes = fmt.Sprintf("%d rows", x.Rows)
+			}
+			if x.Schema != y.Schema {
+				changes += ", schema changed"
+			}
+			fmt.Printf("  ~ %s (%s)\n", name, changes)
+		}
+	}
+
+	if d.Empty() {
+		fmt.Println("\nNo differences found")
+	}
+}
+
+// onlyIn returns the name of the snapshot a when inA is set, otherwise b
+func onlyIn(a, b *sspak.Snapshot, inA bool) string {
+	if inA {
+		return a.Name
+	}
+
+	return b.Name
+}
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.Flags().
+		BoolVarP(&app.OnlyDB, "db", "", false, "only compare the database")
+
+	diffCmd.Flags().
+		BoolVarP(&app.OnlyAssets, "assets", "", false, "only compare the assets")
+
+	diffCmd.Flags().
+		Bool("size-only", false, "compare assets by size only (faster, skips hashing)")
+
+	diffCmd.Flags().
+		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
+}
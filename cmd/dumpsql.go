@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/sspak"
+	"github.com/axllent/ssbak/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// dumpSQLCmd represents the dump-sql command
+var dumpSQLCmd = &cobra.Command{
+	Use:   "dump-sql <sspak> [<output>]",
+	Short: "Output the database of .sspak backup as plain SQL",
+	Long: `Decompress the database of an .sspak backup to a plain SQL file, or to stdout
+if the output is '-' or omitted.`,
+	Example: `  ssbak dump-sql website.sspak - | grep 'CREATE TABLE'
+  ssbak dump-sql website.sspak - | mysql mydatabase
+  ssbak dump-sql website.sspak database.sql`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(_ *cobra.Command, args []string) error {
+		if !utils.IsFile(args[0]) {
+			return fmt.Errorf("'%s' does not exist", args[0])
+		}
+
+		archive, err := sspak.Probe(args[0])
+		if err != nil {
+			return err
+		}
+
+		if archive.DatabaseFile == "" {
+			return fmt.Errorf("'%s' does not contain a database", args[0])
+		}
+
+		var w io.Writer = os.Stdout
+		if len(args) == 2 && args[1] != "-" {
+			file, err := os.Create(filepath.Clean(args[1]))
+			if err != nil {
+				return err
+			}
+
+			defer func() {
+				if err := file.Close(); err != nil {
+					fmt.Printf("Error closing file: %s\n", err)
+				}
+			}()
+
+			w = file
+		}
+
+		return archive.WriteSQL(w)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(dumpSQLCmd)
+
+	dumpSQLCmd.Flags().
+		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/axllent/ssbak/app"
 	"github.com/axllent/ssbak/internal/sspak"
@@ -13,9 +14,20 @@ import (
 var extractCmd = &cobra.Command{
 	Use:   "extract <sspak> [<output dir>]",
 	Short: "Extract .sspak backup",
-	Long:  `Extract the contents of an .sspak backup.`,
-	Args:  cobra.RangeArgs(1, 2),
-	RunE: func(_ *cobra.Command, args []string) error {
+	Long: `Extract the contents of an .sspak backup.
+
+The assets can be expanded into an 'assets' directory with --unpack, rather than
+extracting the assets tarball.
+
+Individual asset files can be extracted with one or more --assets-path patterns
+(relative to the assets directory, eg: 'Uploads/reports/*.pdf'). Patterns support
+'*', '?', '[a-z]' and '**' for any number of directories.`,
+	Example: `  ssbak extract website.sspak
+  ssbak extract website.sspak --db --decompress
+  ssbak extract website.sspak --assets --unpack --ignore-resampled
+  ssbak extract website.sspak --assets-path 'Uploads/reports/*.pdf' ./out`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
 		outputDir := "."
 		if len(args) == 2 {
 			outputDir = args[1]
@@ -25,10 +37,39 @@ var extractCmd = &cobra.Command{
 			return errors.New("you cannot use --assets and --db flags together")
 		}
 
+		if app.Unpack && app.OnlyDB {
+			return errors.New("you cannot use --unpack and --db flags together")
+		}
+
+		assetsPaths, _ := cmd.Flags().GetStringArray("assets-path")
+		if len(assetsPaths) > 0 && app.OnlyDB {
+			return errors.New("you cannot use --assets-path and --db flags together")
+		}
+
 		if err := utils.MkDirIfNotExists(outputDir); err != nil {
 			return err
 		}
 
+		if len(assetsPaths) > 0 {
+			archive, err := sspak.Probe(args[0])
+			if err != nil {
+				return err
+			}
+
+			if archive.AssetsFile == "" {
+				return fmt.Errorf("'%s' does not contain any assets", args[0])
+			}
+
+			stats, err := archive.ExtractAssetFiles(outputDir, assetsPaths)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Extracted %d files\n", stats.Added+stats.Overwritten)
+
+			return nil
+		}
+
 		return sspak.Extract(args[0], outputDir)
 	},
 }
@@ -42,6 +83,20 @@ func init() {
 	extractCmd.Flags().
 		BoolVarP(&app.OnlyAssets, "assets", "", false, "only extract the assets.tar.gz file")
 
+	extractCmd.Flags().
+		BoolVarP(&app.Decompress, "decompress", "d", false, "extract the database as plain SQL (database.sql)")
+
+	extractCmd.Flags().
+		BoolVarP(&app.Unpack, "unpack", "u", false, "unpack the assets into an 'assets' directory")
+
+	extractCmd.Flags().
+		BoolVarP(&app.IgnoreResampled, "ignore-resampled", "i", false, "ignore most resampled images (with --unpack or --assets-path)")
+
+	addResampledFlags(extractCmd)
+
+	extractCmd.Flags().
+		StringArrayP("assets-path", "p", []string{}, "only extract asset files matching the pattern (repeatable)")
+
 	extractCmd.Flags().
 		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
 }
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// addFilterFlags adds the flags to include or exclude asset files
+func addFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().
+		StringArrayVar(&app.Includes, "include", []string{}, "only include asset files matching a pattern, eg: 'Uploads/**/*.pdf' (repeatable)")
+
+	cmd.Flags().
+		StringArrayVar(&app.Excludes, "exclude", []string{}, "exclude asset files matching a pattern, eg: 'Uploads/videos/**' (repeatable)")
+
+	cmd.Flags().
+		String("exclude-larger-than", "", "exclude asset files larger than a size, eg: 500M")
+}
+
+// filterFromFlags sets the asset size limit from the flags
+func filterFromFlags(cmd *cobra.Command) error {
+	size, _ := cmd.Flags().GetString("exclude-larger-than")
+	if size == "" {
+		app.ExcludeLargerThan = 0
+		return nil
+	}
+
+	limit, err := utils.ParseSize(size)
+	if err != nil {
+		return err
+	}
+	app.ExcludeLargerThan = limit
+
+	return nil
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// hooks are the shell commands run before & after an operation (save or load),
+// from the config file followed by the flags. They are run in the webroot with
+// the environment variables:
+//
+//	SSBAK_HOOK       the hook, eg: pre-load
+//	SSBAK_OPERATION  save or load
+//	SSBAK_ARCHIVE    the absolute path of the .sspak archive
+//	SSBAK_WEBROOT    the absolute path of the webroot
+//	SSBAK_DB_NAME    the database name, if any
+//	SSBAK_STATUS     pending (pre hooks), success (post hooks) or error (on-error hooks)
+//	SSBAK_ERROR      the error message (on-error hooks)
+type hooks struct {
+	operation string
+	archive   string
+	pre       []string
+	post      []string
+	onError   []string
+}
+
+// addHookFlags adds the hook flags of the operation to cmd
+func addHookFlags(cmd *cobra.Command, operation string) {
+	cmd.Flags().
+		StringArrayP("pre-"+operation+"-cmd", "", []string{}, "run a shell command in the webroot before the "+operation+", aborting if it fails (repeatable)")
+
+	cmd.Flags().
+		StringArrayP("post-"+operation+"-cmd", "", []string{}, "run a shell command in the webroot after the "+operation+" (repeatable)")
+
+	cmd.Flags().
+		StringArrayP("on-error-cmd", "", []string{}, "run a shell command in the webroot if the "+operation+" fails (repeatable)")
+}
+
+// hooksFromFlags returns the hooks of the operation on the archive, from the
+// config file and the flags
+func hooksFromFlags(cmd *cobra.Command, operation, archive string) *hooks {
+	h := &hooks{operation: operation, archive: archive}
+
+	switch operation {
+	case "save":
+		h.pre, h.post = app.Hooks.PreSave, app.Hooks.PostSave
+	case "load":
+		h.pre, h.post = app.Hooks.PreLoad, app.Hooks.PostLoad
+	}
+	h.onError = app.Hooks.OnError
+
+	pre, _ := cmd.Flags().GetStringArray("pre-" + operation + "-cmd")
+	post, _ := cmd.Flags().GetStringArray("post-" + operation + "-cmd")
+	onError, _ := cmd.Flags().GetStringArray("on-error-cmd")
+
+	h.pre = append(append([]string{}, h.pre...), pre...)
+	h.post = append(append([]string{}, h.post...), post...)
+	h.onError = append(append([]string{}, h.onError...), onError...)
+
+	return h
+}
+
+// runPre runs the pre hooks, running the on-error hooks if any fail
+func (h *hooks) runPre() error {
+	if err := h.run("pre-"+h.operation, h.pre, "pending", nil); err != nil {
+		return h.fail(err)
+	}
+
+	return nil
+}
+
+// runPost runs the post hooks, running the on-error hooks if any fail
+func (h *hooks) runPost() error {
+	if err := h.run("post-"+h.operation, h.post, "success", nil); err != nil {
+		return h.fail(err)
+	}
+
+	return nil
+}
+
+// fail runs the on-error hooks and returns err. Failing on-error hooks are
+// reported, but do not replace err.
+func (h *hooks) fail(err error) error {
+	if hookErr := h.run("on-error", h.onError, "error", err); hookErr != nil {
+		fmt.Printf("Warning: on-error hook %s\n", hookErr.Error())
+	}
+
+	return err
+}
+
+// run runs the commands of hook in order, stopping at the first failure
+func (h *hooks) run(hook string, commands []string, status string, opErr error) error {
+	if len(commands) == 0 {
+		return nil
+	}
+
+	env := []string{
+		"SSBAK_HOOK=" + hook,
+		"SSBAK_OPERATION=" + h.operation,
+		"SSBAK_ARCHIVE=" + absPath(h.archive),
+		"SSBAK_WEBROOT=" + absPath(app.ProjectRoot),
+		"SSBAK_DB_NAME=" + app.DB.Name,
+		"SSBAK_STATUS=" + status,
+	}
+	if opErr != nil {
+		env = append(env, "SSBAK_ERROR="+opErr.Error())
+	}
+
+	app.Log(fmt.Sprintf("Running %s hooks", hook))
+
+	for _, c := range commands {
+		if err := utils.RunCommand(app.ProjectRoot, c, env); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// absPath returns the absolute path of p, or p if it cannot be resolved
+func absPath(p string) string {
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+
+	return p
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHooksFromFlagsOrder(t *testing.T) {
+	saved := app.Hooks
+	defer func() { app.Hooks = saved }()
+
+	app.Hooks = app.HookCommands{
+		PreLoad:  []string{"config-pre"},
+		PostLoad: []string{"config-post"},
+		OnError:  []string{"config-error"},
+	}
+
+	cmd := &cobra.Command{}
+	addHookFlags(cmd, "load")
+	require.NoError(t, cmd.Flags().Parse([]string{
+		"--pre-load-cmd", "flag-pre-1",
+		"--pre-load-cmd", "flag-pre-2",
+		"--post-load-cmd", "flag-post",
+		"--on-error-cmd", "flag-error",
+	}))
+
+	h := hooksFromFlags(cmd, "load", "site.sspak")
+
+	// config file hooks run before the flag hooks
+	assert.Equal(t, []string{"config-pre", "flag-pre-1", "flag-pre-2"}, h.pre)
+	assert.Equal(t, []string{"config-post", "flag-post"}, h.post)
+	assert.Equal(t, []string{"config-error", "flag-error"}, h.onError)
+
+	// the config hooks are not modified
+	assert.Equal(t, []string{"config-pre"}, app.Hooks.PreLoad)
+}
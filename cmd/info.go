@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/sspak"
+	"github.com/axllent/ssbak/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// infoCmd represents the info command
+var infoCmd = &cobra.Command{
+	Use:     "info <sspak>",
+	Short:   "Show the contents of .sspak backup",
+	Long:    `Show the database, assets, protected assets, additional directories, code and git-remote (repository and commit of the site code) of an .sspak backup.`,
+	Example: `  ssbak info website.sspak`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		if !utils.IsFile(args[0]) {
+			return fmt.Errorf("'%s' does not exist", args[0])
+		}
+
+		archive, err := sspak.Probe(args[0])
+		if err != nil {
+			return err
+		}
+
+		size, err := utils.CalcSize(args[0])
+		if err != nil {
+			return err
+		}
+
+		format := "tar"
+		if executable, _ := sspak.IsExecutable(args[0]); executable {
+			format = "executable"
+		}
+
+		fmt.Printf("Archive:     %s (%s, %s)\n", args[0], utils.ByteToHr(size), format)
+
+		for _, entry := range []struct{ label, name string }{
+			{"Database:", archive.DatabaseFile},
+			{"Assets:", archive.AssetsFile},
+			{"Protected:", archive.ProtectedAssetsFile},
+			{"Directories:", archive.DirectoriesFile},
+			{"Code:", archive.CodeFile},
+		} {
+			if entry.name == "" {
+				fmt.Printf("%-12s none\n", entry.label)
+				continue
+			}
+
+			size, err := archive.EntrySize(entry.name)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%-12s %s (%s)\n", entry.label, entry.name, utils.ByteToHr(size))
+		}
+
+		if archive.GitRemoteFile == "" {
+			fmt.Printf("%-12s none\n", "Git remote:")
+			return nil
+		}
+
+		remote, err := archive.GitRemote()
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("%-12s %s\n", "Git remote:", remote.Remote)
+		if remote.Branch != "" {
+			fmt.Printf("%-12s %s\n", "Git branch:", remote.Branch)
+		}
+		fmt.Printf("%-12s %s\n", "Git commit:", remote.SHA)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(infoCmd)
+
+	infoCmd.Flags().
+		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
+}
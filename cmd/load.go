@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"path"
+	"strings"
 
 	"github.com/axllent/ssbak/app"
 	"github.com/axllent/ssbak/internal/sspak"
@@ -13,16 +14,34 @@ import (
 
 // loadCmd represents the load command
 var loadCmd = &cobra.Command{
-	Use:     "load <sspak> [<webroot>]",
-	Short:   "Restore database and/or assets from .sspak backup",
-	Long:    `Restore an .sspak file for a Silverstripe site. Deletes existing table data & assets so be careful!`,
-	Example: `  ssbak load website.sspak`,
-	Args:    cobra.RangeArgs(1, 2),
+	Use:   "load <sspak> [<webroot>]",
+	Short: "Restore database and/or assets from .sspak backup",
+	Long: `Restore an .sspak file for a Silverstripe site. Deletes existing table data & assets so be careful!
+
+After a restore the Silverstripe cache (TEMP_PATH, or silverstripe-cache in the
+webroot) is cleared, and any --post-load-cmd commands are run in the webroot,
+eg: to rebuild the database and regenerate resampled images on demand.
+
+Hook commands (--pre-load-cmd, --post-load-cmd, --on-error-cmd, or the hooks in
+the config file) receive SSBAK_HOOK, SSBAK_OPERATION, SSBAK_ARCHIVE,
+SSBAK_WEBROOT, SSBAK_DB_NAME, SSBAK_STATUS and SSBAK_ERROR environment variables.
+The restore is aborted if a --pre-load-cmd fails.`,
+	Example: `  ssbak load website.sspak
+  ssbak load website.sspak --ignore-resampled --post-load-cmd 'vendor/bin/sake dev/build flush=1'
+  ssbak load website.sspak --pre-load-cmd 'touch .maintenance' --post-load-cmd 'rm .maintenance'
+  ssbak load website.sspak --table Member --table 'SiteTree*'
+  ssbak load website.sspak --table Member --into-table Member_restored
+  ssbak load website.sspak --rewrite-url https://www.example.com=https://staging.example.com`,
+	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if !utils.IsFile(args[0]) {
 			return fmt.Errorf("'%s' does not exist", args[0])
 		}
 
+		if err := filterFromFlags(cmd); err != nil {
+			return err
+		}
+
 		if app.OnlyAssets && app.OnlyDB {
 			return errors.New("you cannot use --assets and --db flags together")
 		}
@@ -37,32 +56,413 @@ var loadCmd = &cobra.Command{
 			return err
 		}
 
-		if archive.DatabaseFile != "" && !app.OnlyAssets {
-			if err := app.BootstrapEnv(app.ProjectRoot); err != nil {
+		dropDatabase, _ := cmd.Flags().GetBool("drop-db")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		backupFirst, _ := cmd.Flags().GetBool("backup-first")
+		atomic, _ := cmd.Flags().GetBool("atomic")
+		keepOldTables, _ := cmd.Flags().GetBool("keep-old-tables")
+		clearCache, _ := cmd.Flags().GetBool("clear-cache")
+
+		loadCode, _ := cmd.Flags().GetBool("code")
+		if loadCode && archive.CodeFile == "" {
+			return fmt.Errorf("'%s' does not contain any code", args[0])
+		}
+
+		merge, _ := cmd.Flags().GetBool("merge")
+		conflict, _ := cmd.Flags().GetString("conflict")
+
+		if keepOldTables && !atomic {
+			return errors.New("--keep-old-tables can only be used with --atomic")
+		}
+
+		policy, err := sspak.ParseConflictPolicy(conflict)
+		if err != nil {
+			return err
+		}
+
+		if app.IntoTable != "" && len(app.Tables) == 0 {
+			return errors.New("--into-table requires --table")
+		}
+
+		if len(app.Tables) > 0 && dropDatabase {
+			return errors.New("you cannot use --table and --drop-db flags together")
+		}
+
+		if len(app.Tables) > 0 && app.OnlyAssets {
+			return errors.New("you cannot use --table and --assets flags together")
+		}
+
+		if merge && app.KeepOldAssets {
+			return errors.New("--keep-old-assets cannot be used with --merge")
+		}
+
+		for _, r := range app.RewriteURLs {
+			if _, _, err := sspak.ParseURLRewrite(r); err != nil {
 				return err
 			}
+		}
+
+		loadDatabase := archive.DatabaseFile != "" && !app.OnlyAssets
+		// restoring individual tables never touches the assets
+		loadAssets := archive.AssetsFile != "" && !app.OnlyDB && len(app.Tables) == 0
 
-			dropDatabase, _ := cmd.Flags().GetBool("drop-db")
-			if err := archive.LoadDatabase(dropDatabase); err != nil {
+		if loadDatabase {
+			if err := app.BootstrapEnv(app.ProjectRoot); err != nil {
+				return err
+			}
+		} else if loadAssets && (archive.ProtectedAssetsFile != "" || (clearCache && utils.IsDir(app.ProjectRoot))) {
+			// the protected assets & cache paths may be set in the environment
+			if err := app.LoadEnv(app.ProjectRoot); err != nil {
 				return err
 			}
 		}
 
-		if archive.AssetsFile != "" && !app.OnlyDB {
-			var assetsBase string
-			if utils.IsDir(path.Join(app.ProjectRoot, "public")) {
-				assetsBase = path.Join(app.ProjectRoot, "public")
-			} else {
-				assetsBase = app.ProjectRoot
+		warnGitRemote(archive)
+
+		opts := loadOptions{
+			database:      loadDatabase,
+			assets:        loadAssets,
+			code:          loadCode,
+			dropDatabase:  dropDatabase,
+			backupFirst:   backupFirst,
+			atomic:        atomic,
+			keepOldTables: keepOldTables,
+			merge:         merge,
+			policy:        policy,
+			clearCache:    clearCache,
+		}
+
+		h := hooksFromFlags(cmd, "load", args[0])
+
+		if dryRun {
+			return loadDryRun(archive, opts, h)
+		}
+
+		if err := h.runPre(); err != nil {
+			return err
+		}
+
+		if err := loadArchive(archive, opts); err != nil {
+			return h.fail(err)
+		}
+
+		return h.runPost()
+	},
+}
+
+// loadOptions are the options of a load
+type loadOptions struct {
+	database      bool
+	assets        bool
+	code          bool
+	dropDatabase  bool
+	backupFirst   bool
+	atomic        bool
+	keepOldTables bool
+	merge         bool
+	policy        sspak.ConflictPolicy
+	clearCache    bool
+}
+
+// loadArchive restores the archive according to opts, rolling back the
+// database & assets (including the protected assets & additional directories)
+// if --backup-first is set and the restore fails
+func loadArchive(archive *sspak.File, opts loadOptions) error {
+	var rollback *sspak.Rollback
+	var err error
+
+	if opts.backupFirst {
+		rollback, err = sspak.CreateRollback(archive, assetsBase(), opts.database, opts.assets)
+		if err != nil {
+			return fmt.Errorf("error creating rollback snapshot: %s", err.Error())
+		}
+	}
+
+	if opts.database {
+		if opts.atomic {
+			err = archive.LoadDatabaseAtomic(opts.dropDatabase, opts.keepOldTables)
+		} else {
+			err = archive.LoadDatabase(opts.dropDatabase)
+		}
+		if err != nil {
+			if rollback != nil {
+				if rbErr := rollback.Restore(assetsBase(), true, false); rbErr != nil {
+					return fmt.Errorf("%s; %s", err.Error(), rbErr.Error())
+				}
+			}
+			return err
+		}
+	}
+
+	if opts.assets {
+		if opts.merge {
+			var stats sspak.ExtractStats
+			stats, err = archive.MergeAssets(assetsBase(), opts.policy)
+			if err == nil {
+				fmt.Printf("Merged assets: %d added, %d skipped, %d overwritten\n", stats.Added, stats.Skipped, stats.Overwritten)
+			}
+		} else {
+			err = archive.LoadAssets(assetsBase())
+		}
+		if err == nil {
+			err = loadAssetDirectories(archive, opts.merge, opts.policy)
+		}
+		if err != nil {
+			if rollback != nil {
+				if rbErr := rollback.Restore(assetsBase(), opts.database, true); rbErr != nil {
+					return fmt.Errorf("%s; %s", err.Error(), rbErr.Error())
+				}
 			}
+			return err
+		}
+	}
 
-			if err := archive.LoadAssets(assetsBase); err != nil {
-				return err
+	if rollback != nil {
+		if err := rollback.Discard(); err != nil {
+			return err
+		}
+	}
+
+	// the code is restored last so that the restore uses the existing environment,
+	// and is not covered by the rollback snapshot
+	if opts.code {
+		stats, err := archive.LoadCode(app.ProjectRoot)
+		if err != nil {
+			if opts.backupFirst {
+				return fmt.Errorf("%s (the code is not rolled back by --backup-first)", err.Error())
 			}
+			return err
 		}
+		fmt.Printf("Restored code: %d added, %d overwritten\n", stats.Added, stats.Overwritten)
+	}
+
+	if opts.clearCache && (opts.database || opts.assets || opts.code) {
+		if err := clearSilverstripeCache(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
+// clearSilverstripeCache removes the contents of the Silverstripe cache directory, if found
+func clearSilverstripeCache() error {
+	dir := app.CacheDir()
+	if dir == "" || !utils.IsDir(dir) {
+		app.Log("No Silverstripe cache directory found")
 		return nil
-	},
+	}
+
+	// never clear the webroot, /tmp etc if TEMP_PATH is misconfigured
+	if err := utils.CheckClearable(dir, app.ProjectRoot); err != nil {
+		fmt.Printf("Warning: not clearing the Silverstripe cache: %s\n", err.Error())
+		return nil
+	}
+
+	app.Log(fmt.Sprintf("Clearing Silverstripe cache '%s'", dir))
+
+	if err := utils.ClearDir(dir); err != nil {
+		return fmt.Errorf("error clearing cache: %s", err.Error())
+	}
+
+	fmt.Printf("Cleared the Silverstripe cache '%s'\n", dir)
+
+	return nil
+}
+
+// loadDryRun reports what a load would do without modifying the database or assets
+func loadDryRun(archive *sspak.File, opts loadOptions, h *hooks) error {
+	fmt.Println("Dry run: no changes will be made")
+
+	if opts.database {
+		plan, err := archive.PlanDatabase(opts.dropDatabase, opts.atomic)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("\nDatabase (%s):\n", archive.DatabaseFile)
+		fmt.Printf("  Host:        %s\n", plan.Host)
+		if plan.Exists {
+			fmt.Printf("  Database:    %s (exists, %d tables)\n", plan.Name, len(plan.ExistingTables))
+		} else {
+			fmt.Printf("  Database:    %s (does not exist, will be created)\n", plan.Name)
+		}
+		if plan.ShadowDatabase != "" {
+			fmt.Printf("  Action:      import into %s, then swap the tables in with a single RENAME TABLE\n", plan.ShadowDatabase)
+		} else if opts.dropDatabase && plan.Exists {
+			fmt.Println("  Action:      drop and recreate database")
+		}
+		printTables("Create", plan.CreateTables)
+		printTables("Overwrite", plan.OverwriteTables)
+		printTables("Drop", plan.DropTables)
+		printTables("Untouched", plan.KeepTables)
+		if len(plan.OldTables) > 0 {
+			action := "dropped after the swap"
+			if opts.keepOldTables {
+				action = "kept after the swap"
+			}
+			fmt.Printf("  Old tables:  %d tables (%s), %s\n", len(plan.OldTables), strings.Join(plan.OldTables, ", "), action)
+		}
+		if plan.SwapErr != nil {
+			fmt.Printf("  Warning:     %s\n", plan.SwapErr.Error())
+		}
+		for _, r := range app.RewriteURLs {
+			from, to, _ := sspak.ParseURLRewrite(r)
+			fmt.Printf("  Rewrite:     %s -> %s\n", from, to)
+		}
+	}
+
+	if opts.assets {
+		var plan *sspak.AssetsPlan
+		var err error
+		if opts.merge {
+			plan, err = archive.PlanMergeAssets(assetsBase(), opts.policy)
+		} else {
+			plan, err = archive.PlanAssets(assetsBase())
+		}
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("\nAssets (%s):\n", archive.AssetsFile)
+		if opts.merge {
+			fmt.Printf("  Merge:       %s (existing files: %s, nothing deleted)\n", plan.Path, plan.Policy)
+		} else if plan.Exists && app.KeepOldAssets {
+			fmt.Printf("  Replace:     %s (%s, kept as %s.old-<timestamp>)\n", plan.Path, utils.ByteToHr(plan.ExistingSize), plan.Path)
+		} else if plan.Exists {
+			fmt.Printf("  Replace:     %s (%s, deleted after restore)\n", plan.Path, utils.ByteToHr(plan.ExistingSize))
+		} else {
+			fmt.Printf("  Create:      %s\n", plan.Path)
+		}
+		if opts.merge {
+			fmt.Printf("  Files:       %d (%d added, %d skipped, %d overwritten)\n", plan.Files, plan.Merge.Added, plan.Merge.Skipped, plan.Merge.Overwritten)
+		} else {
+			fmt.Printf("  Files:       %d\n", plan.Files)
+		}
+		if plan.Skipped > 0 {
+			fmt.Printf("  Skipped:     %d resampled images\n", plan.Skipped)
+		}
+		if plan.Excluded > 0 {
+			fmt.Printf("  Excluded:    %d files\n", plan.Excluded)
+		}
+		fmt.Printf("  Required:    %s\n", utils.ByteToHr(plan.RequiredSize))
+		if plan.FreeSpace >= 0 {
+			fmt.Printf("  Available:   %s\n", utils.ByteToHr(plan.FreeSpace))
+			if plan.RequiredSize > plan.FreeSpace {
+				fmt.Println("  Warning:     insufficient disk space")
+			}
+		}
+	}
+
+	if opts.assets && archive.ProtectedAssetsFile != "" {
+		fmt.Printf("\nProtected assets (%s):\n", archive.ProtectedAssetsFile)
+		fmt.Printf("  Restore:     %s\n", sspak.ProtectedAssetsDir(assetsBase()))
+	}
+
+	if opts.assets && archive.DirectoriesFile != "" {
+		fmt.Printf("\nAdditional directories (%s):\n", archive.DirectoriesFile)
+		fmt.Printf("  Extract:     %s (existing files overwritten, nothing deleted)\n", app.ProjectRoot)
+	}
+
+	if opts.code {
+		fmt.Printf("\nCode (%s):\n", archive.CodeFile)
+		fmt.Printf("  Extract:     %s (existing files overwritten, nothing deleted)\n", app.ProjectRoot)
+	}
+
+	if len(h.pre) > 0 {
+		fmt.Println("\nPre-load:")
+		for _, c := range h.pre {
+			fmt.Printf("  Run:         %s\n", c)
+		}
+	}
+
+	cacheDir := app.CacheDir()
+	clearing := opts.clearCache && cacheDir != "" && (opts.database || opts.assets || opts.code)
+	if clearing || len(h.post) > 0 {
+		fmt.Println("\nPost-load:")
+		if err := utils.CheckClearable(cacheDir, app.ProjectRoot); clearing && err != nil {
+			fmt.Printf("  Clear cache: refused, %s\n", err.Error())
+		} else if clearing {
+			fmt.Printf("  Clear cache: %s\n", cacheDir)
+		}
+		for _, c := range h.post {
+			fmt.Printf("  Run:         %s\n", c)
+		}
+	}
+
+	return nil
+}
+
+// loadAssetDirectories restores the protected assets and additional directories
+// of the archive, if any, merging them when merge is set
+func loadAssetDirectories(archive *sspak.File, merge bool, policy sspak.ConflictPolicy) error {
+	if archive.ProtectedAssetsFile != "" {
+		protectedDir := sspak.ProtectedAssetsDir(assetsBase())
+		if merge {
+			stats, err := archive.MergeProtectedAssets(protectedDir, policy)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Merged protected assets: %d added, %d skipped, %d overwritten\n", stats.Added, stats.Skipped, stats.Overwritten)
+		} else if err := archive.LoadProtectedAssets(protectedDir); err != nil {
+			return err
+		}
+	}
+
+	if archive.DirectoriesFile != "" {
+		if !merge {
+			policy = sspak.ConflictOverwrite
+		}
+		stats, err := archive.LoadDirectories(app.ProjectRoot, policy)
+		if err != nil {
+			return err
+		}
+		app.Log(fmt.Sprintf("Restored additional directories: %d added, %d skipped, %d overwritten", stats.Added, stats.Skipped, stats.Overwritten))
+	}
+
+	return nil
+}
+
+// warnGitRemote prints a warning if the archive was created from a different
+// commit of the site code than the local checkout
+func warnGitRemote(archive *sspak.File) {
+	if archive.GitRemoteFile == "" {
+		return
+	}
+
+	archived, err := archive.GitRemote()
+	if err != nil {
+		app.Log(fmt.Sprintf("Could not read git-remote: %s", err.Error()))
+		return
+	}
+
+	local, err := sspak.ReadGitRemote(app.ProjectRoot)
+	if err != nil {
+		app.Log(fmt.Sprintf("Could not read local git checkout: %s", err.Error()))
+		return
+	}
+
+	if local.SHA != archived.SHA {
+		fmt.Printf("Warning: the archive was created from commit %s, but the local checkout is at %s\n", archived.SHA, local.SHA)
+	}
+}
+
+// printTables prints a labelled, comma-separated list of tables
+func printTables(label string, tables []string) {
+	if len(tables) == 0 {
+		return
+	}
+
+	fmt.Printf("  %-12s %d tables (%s)\n", label+":", len(tables), strings.Join(tables, ", "))
+}
+
+// assetsBase returns the directory containing the assets folder of the project
+func assetsBase() string {
+	if utils.IsDir(path.Join(app.ProjectRoot, "public")) {
+		return path.Join(app.ProjectRoot, "public")
+	}
+
+	return app.ProjectRoot
 }
 
 func init() {
@@ -71,6 +471,39 @@ func init() {
 	loadCmd.Flags().
 		BoolP("drop-db", "", false, "drop existing database (if exists)")
 
+	loadCmd.Flags().
+		BoolP("dry-run", "n", false, "report what would be restored without making any changes")
+
+	loadCmd.Flags().
+		StringArrayVarP(&app.Tables, "table", "t", []string{}, "only restore matching database tables (not assets), supports wildcards (repeatable)")
+
+	loadCmd.Flags().
+		StringVarP(&app.IntoTable, "into-table", "", "", "restore the matching table under a different name (requires --table)")
+
+	loadCmd.Flags().
+		StringArrayVarP(&app.RewriteURLs, "rewrite-url", "", []string{}, "replace a URL in the database, eg: https://www.example.com=https://staging.example.com (repeatable)")
+
+	loadCmd.Flags().
+		BoolP("backup-first", "", false, "snapshot the current database, assets, protected assets & additional directories, and roll back if the restore fails (the code is not included)")
+
+	loadCmd.Flags().
+		BoolP("atomic", "", false, "import into a temporary database & atomically swap the tables into place")
+
+	loadCmd.Flags().
+		BoolP("keep-old-tables", "", false, "keep the replaced tables with an _old suffix (requires --atomic), existing _old tables are never overwritten")
+
+	loadCmd.Flags().
+		BoolVarP(&app.KeepOldAssets, "keep-old-assets", "", false, "keep the replaced assets directory with a timestamped name")
+
+	loadCmd.Flags().
+		BoolP("merge", "m", false, "merge the assets into the existing assets without deleting anything")
+
+	loadCmd.Flags().
+		StringP("conflict", "", "skip", "merge policy for existing files: skip, newer or overwrite")
+
+	loadCmd.Flags().
+		BoolP("code", "", false, "also restore the code archive into the webroot")
+
 	loadCmd.Flags().
 		BoolVarP(&app.OnlyDB, "db", "", false, "only restore the database")
 
@@ -80,6 +513,15 @@ func init() {
 	loadCmd.Flags().
 		BoolVarP(&app.IgnoreResampled, "ignore-resampled", "i", false, "ignore most resampled images (experimental)")
 
+	addResampledFlags(loadCmd)
+
+	addFilterFlags(loadCmd)
+
+	loadCmd.Flags().
+		BoolP("clear-cache", "", false, "clear the Silverstripe cache (TEMP_PATH or silverstripe-cache) after restoring")
+
+	addHookFlags(loadCmd, "load")
+
 	loadCmd.Flags().
 		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
 }
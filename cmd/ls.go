@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/sspak"
+	"github.com/axllent/ssbak/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// lsCmd represents the ls command
+var lsCmd = &cobra.Command{
+	Use:   "ls <sspak> [<pattern>...]",
+	Short: "List assets in .sspak backup",
+	Long: `List the asset files in an .sspak backup, with their sizes and modification times.
+
+Optional patterns (relative to the assets directory, eg: 'Uploads/reports/*.pdf')
+limit the listing to matching files. Patterns support '*', '?', '[a-z]' and '**'
+for any number of directories.`,
+	Example: `  ssbak ls website.sspak 'Uploads/**/*.pdf'`,
+	Args:    cobra.MinimumNArgs(1),
+	RunE: func(_ *cobra.Command, args []string) error {
+		if !utils.IsFile(args[0]) {
+			return fmt.Errorf("'%s' does not exist", args[0])
+		}
+
+		archive, err := sspak.Probe(args[0])
+		if err != nil {
+			return err
+		}
+
+		if archive.AssetsFile == "" {
+			return fmt.Errorf("'%s' does not contain any assets", args[0])
+		}
+
+		entries, err := archive.ListAssets(args[1:])
+		if err != nil {
+			return err
+		}
+
+		var total int64
+		for _, e := range entries {
+			fmt.Printf("%10s  %s  %s\n", utils.ByteToHr(e.Size), e.ModTime.Local().Format("2006-01-02 15:04"), e.Name)
+			total += e.Size
+		}
+
+		fmt.Printf("%d files, %s\n", len(entries), utils.ByteToHr(total))
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(lsCmd)
+
+	lsCmd.Flags().
+		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/sspak"
+	"github.com/axllent/ssbak/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// mergeCmd represents the merge command
+var mergeCmd = &cobra.Command{
+	Use:   "merge --db-from <sspak> --assets-from <sspak> <output sspak>",
+	Short: "Combine the database & assets of two .sspak backups",
+	Long: `Create an .sspak backup from the database of one .sspak backup and the assets of another.
+
+The database and assets are copied across as-is, without decompression.`,
+	Example: `  ssbak merge --db-from nightly.sspak --assets-from snapshot.sspak website.sspak`,
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dbFrom, _ := cmd.Flags().GetString("db-from")
+		assetsFrom, _ := cmd.Flags().GetString("assets-from")
+
+		if dbFrom == "" && assetsFrom == "" {
+			return errors.New("you must specify either --db-from or --assets-from, or both")
+		}
+
+		var db, assets *sspak.File
+		var err error
+
+		if dbFrom != "" {
+			if db, err = probeMergeSource(dbFrom, args[0]); err != nil {
+				return err
+			}
+		}
+
+		if assetsFrom != "" {
+			if assets, err = probeMergeSource(assetsFrom, args[0]); err != nil {
+				return err
+			}
+		}
+
+		merged, err := sspak.Merge(db, assets)
+		if err != nil {
+			return err
+		}
+
+		return merged.Write(args[0])
+	},
+}
+
+// probeMergeSource probes the source sspak file, ensuring it is not the output file
+func probeMergeSource(file, output string) (*sspak.File, error) {
+	if !utils.IsFile(file) {
+		return nil, fmt.Errorf("'%s' does not exist", file)
+	}
+
+	if sameFile(file, output) {
+		return nil, fmt.Errorf("the output file cannot be the same as '%s'", file)
+	}
+
+	return sspak.Probe(file)
+}
+
+// sameFile returns whether the paths a and b refer to the same file
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+
+	return errA == nil && errB == nil && absA == absB
+}
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+
+	mergeCmd.Flags().
+		String("db-from", "", "the .sspak backup to copy the database from")
+
+	mergeCmd.Flags().
+		String("assets-from", "", "the .sspak backup to copy the assets from")
+
+	mergeCmd.Flags().
+		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
+}
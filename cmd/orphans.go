@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/sspak"
+	"github.com/axllent/ssbak/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// orphansCmd represents the orphans command
+var orphansCmd = &cobra.Command{
+	Use:   "orphans <webroot>",
+	Short: "List assets not referenced by the database",
+	Long: `List the asset files of a website that are not referenced by any File record
+in the database (the File, File_Live and File_Versions tables), and how much
+space 'ssbak save --only-referenced-assets' would save.
+
+Variants of referenced files (eg: resized images), hidden files such as
+.htaccess, web.config files and generated error pages are never reported.`,
+	Example: `  ssbak orphans ./
+  ssbak orphans ./ --summary`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := app.BootstrapEnv(args[0]); err != nil {
+			return err
+		}
+
+		assetsDir, err := locateAssetsDir(app.ProjectRoot)
+		if err != nil {
+			return err
+		}
+
+		referenced, err := sspak.LoadReferencedAssets()
+		if err != nil {
+			return err
+		}
+
+		report, err := sspak.DirOrphanReport(assetsDir, referenced)
+		if err != nil {
+			return err
+		}
+
+		summary, _ := cmd.Flags().GetBool("summary")
+		if !summary {
+			for _, f := range report.Files {
+				fmt.Printf("%10s  %s\n", utils.ByteToHr(f.Size), f.Name)
+			}
+		}
+
+		var percent float64
+		if report.TotalSize > 0 {
+			percent = float64(report.OrphanedSize) / float64(report.TotalSize) * 100
+		}
+
+		fmt.Printf("%d of %d files are not referenced by the database, using %s of %s (%.1f%%)\n",
+			len(report.Files), report.TotalFiles, utils.ByteToHr(report.OrphanedSize), utils.ByteToHr(report.TotalSize), percent)
+
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(orphansCmd)
+
+	orphansCmd.Flags().
+		BoolP("summary", "s", false, "only show the summary")
+
+	orphansCmd.Flags().
+		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/sspak"
+	"github.com/axllent/ssbak/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+// resampledReportCmd represents the resampled-report command
+var resampledReportCmd = &cobra.Command{
+	Use:   "resampled-report <webroot|sspak>",
+	Short: "List the resampled images of a website or .sspak backup",
+	Long: `List the resampled images that --ignore-resampled would drop from a website's
+assets or an .sspak backup, and how much space it would save.
+
+Additional resampled image patterns and exceptions (regular expressions) can be
+set with flags, or in the config file:
+
+  resampled:
+    patterns:
+      - '(?i)__(FocusFillMax|Webp)([a-z0-9_]*)\.[a-z0-9]{1,4}$'
+    exceptions:
+      - '__FitMaxWzM1MiwyNjRd\.'`,
+	Example: `  ssbak resampled-report ./
+  ssbak resampled-report website.sspak --resampled-pattern '__Webp[a-z0-9_]*\.webp$'`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var report *sspak.ResampledReport
+
+		if utils.IsDir(args[0]) {
+			app.ProjectRoot = args[0]
+			assetsDir, err := locateAssetsDir(args[0])
+			if err != nil {
+				return err
+			}
+			report, err = sspak.DirResampledReport(assetsDir)
+			if err != nil {
+				return err
+			}
+		} else if utils.IsFile(args[0]) {
+			archive, err := sspak.Probe(args[0])
+			if err != nil {
+				return err
+			}
+			if archive.AssetsFile == "" {
+				return fmt.Errorf("'%s' does not contain any assets", args[0])
+			}
+			if report, err = archive.ResampledReport(); err != nil {
+				return err
+			}
+		} else {
+			return fmt.Errorf("'%s' does not exist", args[0])
+		}
+
+		summary, _ := cmd.Flags().GetBool("summary")
+		if !summary {
+			for _, f := range report.Files {
+				fmt.Printf("%10s  %s\n", utils.ByteToHr(f.Size), f.Name)
+			}
+		}
+
+		var percent float64
+		if report.TotalSize > 0 {
+			percent = float64(report.ResampledSize) / float64(report.TotalSize) * 100
+		}
+
+		fmt.Printf("%d of %d files are resampled images, saving %s of %s (%.1f%%)\n",
+			len(report.Files), report.TotalFiles, utils.ByteToHr(report.ResampledSize), utils.ByteToHr(report.TotalSize), percent)
+
+		return nil
+	},
+}
+
+// addResampledFlags adds the flags to configure the detection of resampled images
+func addResampledFlags(cmd *cobra.Command) {
+	cmd.Flags().
+		StringArray("resampled-pattern", []string{}, "additional regular expression matching resampled images (repeatable)")
+
+	cmd.Flags().
+		StringArray("resampled-exception", []string{}, "regular expression matching files that are never resampled images (repeatable)")
+}
+
+func init() {
+	rootCmd.AddCommand(resampledReportCmd)
+
+	resampledReportCmd.Flags().
+		BoolP("summary", "s", false, "only show the summary")
+
+	addResampledFlags(resampledReportCmd)
+
+	resampledReportCmd.Flags().
+		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
+}
@@ -8,6 +8,7 @@ import (
 	"syscall"
 
 	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -21,6 +22,14 @@ Support/Documentation
   https://github.com/axllent/ssbak`,
 	SilenceUsage:  true, // suppress help screen on error
 	SilenceErrors: true, // suppress duplicate error on error
+	PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+		// only load the config for the commands using it, so that
+		// an invalid config does not break eg: `ssbak version`
+		if !usesConfig(cmd) {
+			return nil
+		}
+		return loadConfig(cmd)
+	},
 	PersistentPostRunE: func(_ *cobra.Command, _ []string) error {
 		// delete temporary files after completion
 		return app.Cleanup()
@@ -60,7 +69,37 @@ func Execute() {
 	}
 }
 
+// usesConfig returns whether cmd detects resampled images or runs hooks,
+// the only settings of the config file
+func usesConfig(cmd *cobra.Command) bool {
+	return cmd.Flags().Lookup("resampled-pattern") != nil ||
+		cmd.Flags().Lookup("on-error-cmd") != nil
+}
+
+// loadConfig loads the config file (if any) and the resampled image flags
+func loadConfig(cmd *cobra.Command) error {
+	file, _ := cmd.Flags().GetString("config")
+	if file == "" && utils.IsFile(app.DefaultConfigFile()) {
+		file = app.DefaultConfigFile()
+	}
+
+	if file != "" {
+		if err := app.LoadConfig(file); err != nil {
+			return err
+		}
+	}
+
+	// these flags are only defined for commands handling resampled images
+	patterns, _ := cmd.Flags().GetStringArray("resampled-pattern")
+	exceptions, _ := cmd.Flags().GetStringArray("resampled-exception")
+
+	return app.AddResampledPatterns(patterns, exceptions)
+}
+
 func init() {
+	rootCmd.PersistentFlags().
+		String("config", "", "config file (default "+app.DefaultConfigFile()+")")
+
 	// hide autocompletion
 	rootCmd.CompletionOptions.HiddenDefaultCmd = true
 
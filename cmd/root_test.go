@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvalidConfigOnlyFailsCommandsUsingIt(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(config, []byte("resampled: ["), 0600))
+
+	newCmd := func() *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("config", config, "")
+		return cmd
+	}
+
+	// eg: version, help & completion
+	assert.NoError(t, rootCmd.PersistentPreRunE(newCmd(), nil))
+
+	cmd := newCmd()
+	addResampledFlags(cmd)
+	assert.Error(t, rootCmd.PersistentPreRunE(cmd, nil))
+
+	cmd = newCmd()
+	addHookFlags(cmd, "save")
+	assert.Error(t, rootCmd.PersistentPreRunE(cmd, nil))
+}
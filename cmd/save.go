@@ -2,7 +2,10 @@ package cmd
 
 import (
 	"errors"
+	"fmt"
+	"os"
 	"path"
+	"strings"
 
 	"github.com/axllent/ssbak/app"
 	"github.com/axllent/ssbak/internal/sspak"
@@ -12,12 +15,33 @@ import (
 
 // saveCmd represents the save command
 var saveCmd = &cobra.Command{
-	Use:     "save <webroot> <sspak>",
-	Short:   "Create .sspak backup of database and/or assets",
-	Long:    `Create .sspak archive from a Silverstripe database and/or assets.`,
-	Example: `  ssbak save ./ website.sspak`,
-	Args:    cobra.ExactArgs(2),
-	RunE: func(_ *cobra.Command, args []string) error {
+	Use:   "save <webroot> <sspak>",
+	Short: "Create .sspak backup of database and/or assets",
+	Long: `Create .sspak archive from a Silverstripe database and/or assets.
+
+Hook commands (--pre-save-cmd, --post-save-cmd, --on-error-cmd, or the hooks in
+the config file) receive SSBAK_HOOK, SSBAK_OPERATION, SSBAK_ARCHIVE,
+SSBAK_WEBROOT, SSBAK_DB_NAME, SSBAK_STATUS and SSBAK_ERROR environment variables.
+The save is aborted if a --pre-save-cmd fails.`,
+	Example: `  ssbak save ./ website.sspak
+  ssbak save ./ website.sspak --compression zstd --level 19
+  ssbak save ./ website.sspak --include-git
+  ssbak save ./ website.sspak --only-referenced-assets
+  ssbak save ./ website.sspak --post-save-cmd 'notify "Saved $SSBAK_ARCHIVE"'
+  ssbak save ./ website.sspak --include-dir app/uploads
+  ssbak save ./ website.sspak --code --code-exclude 'public/_resources'`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := filterFromFlags(cmd); err != nil {
+			return err
+		}
+
+		compression, err := compressionFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		sspak.Compression = compression
+
 		if err := app.BootstrapEnv(args[0]); err != nil {
 			return err
 		}
@@ -26,32 +50,106 @@ var saveCmd = &cobra.Command{
 			return errors.New("you cannot use --assets and --db flags together")
 		}
 
-		archive := sspak.New()
+		h := hooksFromFlags(cmd, "save", args[1])
+
+		if err := h.runPre(); err != nil {
+			return err
+		}
+
+		if err := saveArchive(cmd, args[1]); err != nil {
+			return h.fail(err)
+		}
+
+		return h.runPost()
+	},
+}
 
-		if !app.OnlyAssets {
-			if err := archive.AddDatabase(); err != nil {
+// saveArchive creates the .sspak file of the site in app.ProjectRoot
+func saveArchive(cmd *cobra.Command, file string) error {
+	archive := sspak.New()
+
+	if includeGit, _ := cmd.Flags().GetBool("include-git"); includeGit {
+		if err := archive.AddGitRemote(app.ProjectRoot); err != nil {
+			return err
+		}
+	}
+
+	if !app.OnlyAssets {
+		if err := archive.AddDatabase(); err != nil {
+			return err
+		}
+	}
+
+	if !app.OnlyDB {
+		assetsDir, err := locateAssetsDir(app.ProjectRoot)
+		if err != nil {
+			return err
+		}
+
+		if referencedOnly, _ := cmd.Flags().GetBool("only-referenced-assets"); referencedOnly {
+			if sspak.ReferencedOnly, err = sspak.LoadReferencedAssets(); err != nil {
 				return err
 			}
 		}
 
-		if !app.OnlyDB {
-			var assetsDir string
+		if err := archive.AddAssets(assetsDir); err != nil {
+			return err
+		}
 
-			if utils.IsDir(path.Join(app.ProjectRoot, "assets")) {
-				assetsDir = app.RealPath(path.Join(app.ProjectRoot, "assets"))
-			} else if utils.IsDir(path.Join(app.ProjectRoot, "public", "assets")) {
-				assetsDir = app.RealPath(path.Join(app.ProjectRoot, "public", "assets"))
-			} else {
-				return errors.New("could not locate assets directory")
-			}
+		if err := addProtectedAssets(archive, assetsDir); err != nil {
+			return err
+		}
 
-			if err := archive.AddAssets(assetsDir); err != nil {
+		if dirs, _ := cmd.Flags().GetStringArray("include-dir"); len(dirs) > 0 {
+			if err := archive.AddDirectories(app.ProjectRoot, dirs); err != nil {
 				return err
 			}
 		}
+	}
 
-		return archive.Write(args[1])
-	},
+	if code, _ := cmd.Flags().GetBool("code"); code {
+		excludes, _ := cmd.Flags().GetStringArray("code-exclude")
+		if err := archive.AddCode(app.ProjectRoot, append(sspak.DefaultCodeExcludes, excludes...)); err != nil {
+			return err
+		}
+	}
+
+	return archive.Write(file)
+}
+
+// locateAssetsDir returns the assets directory of the webroot (assets or public/assets)
+func locateAssetsDir(webroot string) (string, error) {
+	if utils.IsDir(path.Join(webroot, "assets")) {
+		return app.RealPath(path.Join(webroot, "assets")), nil
+	}
+
+	if utils.IsDir(path.Join(webroot, "public", "assets")) {
+		return app.RealPath(path.Join(webroot, "public", "assets")), nil
+	}
+
+	return "", errors.New("could not locate assets directory")
+}
+
+// addProtectedAssets adds the protected assets store when it is configured
+// outside the assets directory with SS_PROTECTED_ASSETS_PATH
+func addProtectedAssets(archive *sspak.File, assetsDir string) error {
+	if app.ProtectedAssetsPath == "" {
+		// protected assets are included in assets/.protected
+		return nil
+	}
+
+	if !utils.IsDir(app.ProtectedAssetsPath) {
+		app.Log(fmt.Sprintf("Protected assets directory '%s' does not exist, skipping", app.ProtectedAssetsPath))
+		return nil
+	}
+
+	protectedDir := app.RealPath(app.ProtectedAssetsPath)
+	if strings.HasPrefix(protectedDir+string(os.PathSeparator), assetsDir+string(os.PathSeparator)) {
+		app.Log(fmt.Sprintf("Protected assets directory '%s' is within the assets", protectedDir))
+		return nil
+	}
+
+	return archive.AddProtectedAssets(protectedDir)
 }
 
 func init() {
@@ -66,8 +164,31 @@ func init() {
 	saveCmd.Flags().
 		BoolVarP(&app.IgnoreResampled, "ignore-resampled", "i", false, "ignore most resampled images")
 
+	addResampledFlags(saveCmd)
+
 	saveCmd.Flags().
-		BoolVarP(&sspak.UseZSTD, "zstd", "z", false, "use zstd compression (experimental)")
+		BoolP("only-referenced-assets", "", false, "only save asset files referenced by the database (see 'ssbak orphans')")
+
+	saveCmd.Flags().
+		BoolP("include-git", "", false, "record the git remote & commit of the site code")
+
+	saveCmd.Flags().
+		StringArrayP("include-dir", "", []string{}, "add an additional directory within the webroot (repeatable)")
+
+	saveCmd.Flags().
+		BoolP("code", "", false, "add a code archive of the webroot")
+
+	saveCmd.Flags().
+		StringArrayP("code-exclude", "", []string{}, "exclude matching files from the code archive, in addition to '"+strings.Join(sspak.DefaultCodeExcludes, "', '")+"' (repeatable)")
+
+	addCompressionFlags(saveCmd)
+
+	saveCmd.Flags().
+		BoolVarP(&sspak.Executable, "executable", "", false, "create an executable (phar) .sspak archive")
+
+	addFilterFlags(saveCmd)
+
+	addHookFlags(saveCmd, "save")
 
 	saveCmd.Flags().
 		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
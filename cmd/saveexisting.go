@@ -18,6 +18,16 @@ var saveExistingCmd = &cobra.Command{
 	Example: `  ssbak saveexisting website.sspak --db="database.sql" --assets="public/assets"`,
 	Args:    cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := filterFromFlags(cmd); err != nil {
+			return err
+		}
+
+		compression, err := compressionFromFlags(cmd)
+		if err != nil {
+			return err
+		}
+		sspak.Compression = compression
+
 		sqlFile, _ := cmd.Flags().GetString("db")
 		assetsDir, _ := cmd.Flags().GetString("assets")
 
@@ -60,8 +70,12 @@ func init() {
 	saveExistingCmd.Flags().
 		StringP("assets", "", "", "add an existing assets directory")
 
+	addCompressionFlags(saveExistingCmd)
+
 	saveExistingCmd.Flags().
-		BoolVarP(&sspak.UseZSTD, "zstd", "z", false, "use zstd compression (experimental)")
+		BoolVarP(&sspak.Executable, "executable", "", false, "create an executable (phar) .sspak archive")
+
+	addFilterFlags(saveExistingCmd)
 
 	saveExistingCmd.Flags().
 		BoolVarP(&app.Verbose, "verbose", "v", false, "verbose output")
@@ -2,40 +2,22 @@ package sspak
 
 import (
 	"archive/tar"
-	"compress/gzip"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/axllent/ssbak/app"
 	"github.com/axllent/ssbak/internal/utils"
-	"github.com/klauspost/compress/zstd"
 )
 
-// AddAssets adds the assets file to the File struct, given the path to the assets directory. It returns an error if the assets file could not be created.
+// AddAssets adds the assets file to the File struct, given the path to the assets directory,
+// compressed according to Compression (see Compression.Assets). It returns an error if the
+// assets file could not be created.
 func (f *File) AddAssets(assetsDir string) error {
-	app.Log(fmt.Sprintf("Calculating size of '%s'", assetsDir))
-
-	size, _ := utils.CalcSize(assetsDir)
-
-	if err := utils.HasEnoughSpace(f.TempFolder, size); err != nil {
-		return err
-	}
-
-	if UseZSTD {
-		f.AssetsFile = filepath.Join(f.TempFolder, "assets.tar.zst")
-	} else {
-		f.AssetsFile = filepath.Join(f.TempFolder, "assets.tar.gz")
-	}
-
-	app.Log(fmt.Sprintf("Compressing '%s' (%s) to '%s'", assetsDir, utils.ByteToHr(size), f.AssetsFile))
-
-	if app.IgnoreResampled {
-		app.Log("Ignoring resampled images")
-	}
-
 	var err error
 	assetsDir, err = filepath.Abs(assetsDir)
 	if err != nil {
@@ -52,74 +34,125 @@ func (f *File) AddAssets(assetsDir string) error {
 		return errors.New("compress: input directory is empty")
 	}
 
-	file, err := os.Create(f.AssetsFile)
+	filter, err := newAssetsFilter(assetsDir)
+	if err != nil {
+		return err
+	}
+
+	f.AssetsFile, err = f.compressDirectories("assets.tar", []string{assetsDir}, filepath.Dir(assetsDir), filter)
 	if err != nil {
 		return err
 	}
 
-	var (
-		tarWriter  *tar.Writer
-		zstdWriter *zstd.Encoder
-		gzipWriter *gzip.Writer
-	)
+	filter.report()
 
-	if UseZSTD {
-		zstdWriter, err = zstd.NewWriter(file)
-		if err != nil {
-			_ = file.Close()
-			return err
+	return nil
+}
+
+// compressDirectories creates the archive name (plus the compression extension)
+// in the temp folder containing the directories, with paths relative to base,
+// skipping files according to the optional filter. The archive is compressed
+// according to Compression, like the assets.
+func (f *File) compressDirectories(name string, dirs []string, base string, filter *assetsFilter) (string, error) {
+	var size int64
+	for _, dir := range dirs {
+		app.Log(fmt.Sprintf("Calculating size of '%s'", dir))
+		dirSize, _ := utils.CalcSize(dir)
+		size += dirSize
+	}
+
+	if err := utils.HasEnoughSpace(f.TempFolder, size); err != nil {
+		return "", err
+	}
+
+	if app.IgnoreResampled {
+		app.Log("Ignoring resampled images")
+	}
+
+	var sizes assetsSizes
+	if Compression.Assets == CompressionAdaptive {
+		for _, dir := range dirs {
+			dirSizes, err := dirAssetsSizes(dir)
+			if err != nil {
+				return "", err
+			}
+			sizes.total += dirSizes.total
+			sizes.incompressible += dirSizes.incompressible
 		}
-		tarWriter = tar.NewWriter(zstdWriter)
-	} else {
-		gzipWriter = gzip.NewWriter(file)
-		tarWriter = tar.NewWriter(gzipWriter)
 	}
 
-	err = tarAddDirectory(assetsDir, tarWriter, filepath.Dir(assetsDir))
+	compression := Compression.forAssets(sizes)
+
+	archive := filepath.Join(f.TempFolder, name+compression.extension())
+
+	app.Log(fmt.Sprintf("Compressing '%s' (%s) to '%s'", strings.Join(dirs, "', '"), utils.ByteToHr(size), archive))
+
+	file, err := os.Create(archive)
+	if err != nil {
+		return "", err
+	}
+
+	compressor, err := compression.newWriter(file)
 	if err != nil {
-		tarWriter.Close()
-		if zstdWriter != nil {
-			zstdWriter.Close()
-		}
-		if gzipWriter != nil {
-			gzipWriter.Close()
+		_ = file.Close()
+		return "", err
+	}
+
+	tarWriter := tar.NewWriter(compressor)
+
+	for _, dir := range dirs {
+		if err := tarAddDirectory(dir, tarWriter, base, filter); err != nil {
+			_ = tarWriter.Close()
+			_ = compressor.Close()
+			_ = file.Close()
+			return "", err
 		}
-		file.Close()
-		return err
 	}
 
 	// Close tarWriter first to ensure all data is flushed to the underlying writer before closing it.
 	if err = tarWriter.Close(); err != nil {
-		if zstdWriter != nil {
-			_ = zstdWriter.Close()
-		}
-		if gzipWriter != nil {
-			_ = gzipWriter.Close()
-		}
-		file.Close()
+		_ = compressor.Close()
+		_ = file.Close()
+		return "", err
+	}
 
-		return err
+	if err = compressor.Close(); err != nil {
+		_ = file.Close()
+		return "", err
 	}
 
-	if zstdWriter != nil {
-		if err = zstdWriter.Close(); err != nil {
-			file.Close()
+	return archive, file.Close()
+}
+
+// dirAssetsSizes tallies the sizes of the files in assetsDir for adaptive
+// compression, excluding resampled images when app.IgnoreResampled is set
+func dirAssetsSizes(assetsDir string) (assetsSizes, error) {
+	var sizes assetsSizes
+
+	err := filepath.WalkDir(assetsDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || skipResampled(p) {
 			return err
 		}
-	}
-	if gzipWriter != nil {
-		if err = gzipWriter.Close(); err != nil {
-			file.Close()
+
+		info, err := d.Info()
+		if err != nil {
 			return err
 		}
-	}
 
-	return file.Close()
+		sizes.add(d.Name(), info.Size())
+
+		return nil
+	})
+
+	return sizes, err
 }
 
-// LoadAssets extracts the assets archive from f.AssetsFile into assetsBase.
-// Any existing assets directory is renamed to assets.old and scheduled for cleanup.
-// It supports both tar.gz and tar.zst formats.
+// LoadAssets extracts the assets archive from f.AssetsFile into a staging directory
+// within assetsBase, and then swaps it into place with a rename. Any existing
+// assets directory is renamed to assets.old and scheduled for cleanup, or kept
+// with a timestamped name when app.KeepOldAssets is set. Should the extraction
+// fail, the existing assets directory is left untouched.
+// The compression (gzip, zstd, xz or none) is detected from the file contents.
 // When f.SourceSSPak is set the archive entry is streamed directly without temp files.
 func (f *File) LoadAssets(assetsBase string) error {
 	if assetsBase == "" {
@@ -133,52 +166,239 @@ func (f *File) LoadAssets(assetsBase string) error {
 		}
 	}
 
+	if err := os.MkdirAll(assetsBase, 0750); err != nil {
+		return err
+	}
+
+	// the staging directory must be on the same filesystem for an atomic rename
+	staging, err := os.MkdirTemp(assetsBase, ".ssbak-staging-")
+	if err != nil {
+		return err
+	}
+	app.AddTempFile(staging)
+
 	assetsPath := filepath.Join(assetsBase, "assets")
-	if IsDir(assetsPath) {
-		app.Log(fmt.Sprintf("Renaming existing '%s' to '%s.old'", assetsPath, assetsPath))
-		if err := os.Rename(assetsPath, assetsPath+".old"); err != nil {
+
+	app.Log(fmt.Sprintf("Unpacking '%s' to '%s'", f.AssetsFile, staging))
+
+	if app.IgnoreResampled {
+		app.Log("Ignoring resampled images")
+	}
+
+	filter, err := newAssetsFilter(assetsPath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.extractAssetsTo(staging, extractOptions{filter: filter}); err != nil {
+		app.Log(fmt.Sprintf("Extraction failed, removing '%s'", staging))
+		_ = os.RemoveAll(staging)
+		return err
+	}
+
+	filter.report()
+
+	// the archive normally contains a single top-level "assets" directory
+	entries, err := os.ReadDir(staging)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := swapIntoPlace(filepath.Join(staging, entry.Name()), filepath.Join(assetsBase, entry.Name())); err != nil {
 			return err
 		}
-		app.AddTempFile(assetsPath + ".old")
 	}
 
-	app.Log(fmt.Sprintf("Unpacking '%s' to '%s'", f.AssetsFile, assetsPath))
+	if err := os.Remove(staging); err != nil {
+		return err
+	}
+
+	outSize, _ := utils.CalcSize(assetsPath)
+	app.Log(fmt.Sprintf("Restored '%s' (%s)", assetsPath, utils.ByteToHr(outSize)))
+
+	return nil
+}
+
+// MergeAssets extracts the assets archive from f.AssetsFile directly into
+// assetsBase without removing any existing files. Files that already exist are
+// handled according to policy.
+func (f *File) MergeAssets(assetsBase string, policy ConflictPolicy) (ExtractStats, error) {
+	if assetsBase == "" {
+		assetsBase = "."
+	}
+
+	if f.SourceSSPak == "" {
+		inSize, _ := utils.CalcSize(f.AssetsFile)
+		if err := utils.HasEnoughSpace(assetsBase, inSize); err != nil {
+			return ExtractStats{}, err
+		}
+	}
+
+	app.Log(fmt.Sprintf("Merging '%s' into '%s' (existing files: %s)", f.AssetsFile, filepath.Join(assetsBase, "assets"), policy))
 
 	if app.IgnoreResampled {
 		app.Log("Ignoring resampled images")
 	}
 
+	filter, err := newAssetsFilter(filepath.Join(assetsBase, "assets"))
+	if err != nil {
+		return ExtractStats{}, err
+	}
+
+	stats, err := f.extractAssetsTo(assetsBase, extractOptions{conflict: policy, filter: filter})
+	if err != nil {
+		return stats, err
+	}
+
+	filter.report()
+
+	app.Log(fmt.Sprintf("Merged '%s': %d added, %d skipped, %d overwritten", f.AssetsFile, stats.Added, stats.Skipped, stats.Overwritten))
+
+	return stats, nil
+}
+
+// extractAssetsTo extracts f.AssetsFile into directory, streaming the entry
+// directly from the sspak when f.SourceSSPak is set.
+func (f *File) extractAssetsTo(directory string, opts extractOptions) (ExtractStats, error) {
 	if f.SourceSSPak != "" {
 		r, cleanup, err := openSSPakEntry(f.SourceSSPak, f.AssetsFile)
 		if err != nil {
-			return err
+			return ExtractStats{}, err
 		}
 		defer cleanup()
 
-		if err := extractAssetsFromReader(r, strings.HasSuffix(f.AssetsFile, ".tar.zst"), assetsBase); err != nil {
-			return err
+		return extractAssetsFromReader(r, directory, opts)
+	}
+
+	return extractAssets(f.AssetsFile, directory, opts)
+}
+
+// swapIntoPlace renames staged to target. An existing target is first renamed
+// out of the way (and restored should the swap fail), and is either scheduled
+// for cleanup, or kept with a timestamped name when app.KeepOldAssets is set.
+func swapIntoPlace(staged, target string) error {
+	if _, err := os.Lstat(target); err != nil {
+		app.Log(fmt.Sprintf("Moving '%s' to '%s'", staged, target))
+		return os.Rename(staged, target)
+	}
+
+	old := target + ".old"
+	if app.KeepOldAssets || pathExists(old) {
+		old = target + ".old-" + time.Now().Format("20060102-150405")
+	}
+
+	app.Log(fmt.Sprintf("Renaming existing '%s' to '%s'", target, old))
+	if err := os.Rename(target, old); err != nil {
+		return err
+	}
+
+	app.Log(fmt.Sprintf("Moving '%s' to '%s'", staged, target))
+	if err := os.Rename(staged, target); err != nil {
+		app.Log(fmt.Sprintf("Restoring '%s' to '%s'", old, target))
+		if rErr := os.Rename(old, target); rErr != nil {
+			return fmt.Errorf("%s (could not restore '%s': %s)", err.Error(), old, rErr.Error())
 		}
+		return err
+	}
+
+	if app.KeepOldAssets {
+		fmt.Printf("Previous assets kept in '%s'\n", old)
 	} else {
-		if err := extractAssets(f.AssetsFile, assetsBase); err != nil {
-			return err
+		app.AddTempFile(old)
+	}
+
+	return nil
+}
+
+// pathExists returns whether anything (file, directory or symlink) exists at path
+func pathExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// AssetEntry is a file within an assets archive
+type AssetEntry struct {
+	// Name is the path relative to the assets directory
+	Name string
+
+	// Size is the uncompressed size of the file
+	Size int64
+
+	// ModTime is the modification time of the file
+	ModTime time.Time
+}
+
+// ListAssets returns the files in the assets archive, optionally limited to
+// those matching any of the gitignore-style patterns (see matchPattern).
+func (f *File) ListAssets(patterns []string) ([]AssetEntry, error) {
+	rawReader, cleanup, err := f.openEntry(f.AssetsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	reader, err := newDecompressReader(rawReader)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = reader.Close() }()
+
+	entries := []AssetEntry{}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := assetsRelativePath(header.Name)
+		if len(patterns) > 0 && !matchAny(patterns, name) {
+			continue
 		}
+
+		entries = append(entries, AssetEntry{Name: name, Size: header.Size, ModTime: header.ModTime})
 	}
 
-	outSize, _ := utils.CalcSize(assetsPath)
-	app.Log(fmt.Sprintf("Restored '%s' (%s)", assetsPath, utils.ByteToHr(outSize)))
+	return entries, nil
+}
 
-	return nil
+// ExtractAssetFiles extracts only the asset files matching any of the
+// gitignore-style patterns (see matchPattern) into outputDir, preserving their
+// path within the archive (eg: outputDir/assets/Uploads/file.pdf).
+func (f *File) ExtractAssetFiles(outputDir string, patterns []string) (ExtractStats, error) {
+	app.Log(fmt.Sprintf("Extracting files matching '%s' from '%s' to '%s'", strings.Join(patterns, "', '"), f.AssetsFile, outputDir))
+
+	return f.extractAssetsTo(outputDir, extractOptions{
+		match: func(name string) bool {
+			return matchAny(patterns, assetsRelativePath(name))
+		},
+	})
 }
 
 // SkipResampled detects whether the assets is a resampled image
 func skipResampled(filePath string) bool {
-	if !app.IgnoreResampled {
-		return false
+	return app.IgnoreResampled && isResampled(filePath)
+}
+
+// isResampled returns whether the file matches the resampled image patterns
+// (app.ResampledRegex) and none of the exceptions (app.ResampledExceptions)
+func isResampled(filePath string) bool {
+	for _, r := range app.ResampledExceptions {
+		if r.MatchString(filePath) {
+			return false
+		}
 	}
 
 	for _, r := range app.ResampledRegex {
-		// Silverstripe 5 generates thumbnails for CMS previews by default with `__FitMaxWzM1MiwyNjRd`
-		if !strings.Contains(filePath, "__FitMaxWzM1MiwyNjRd.") && r.MatchString(filePath) {
+		if r.MatchString(filePath) {
 			return true
 		}
 	}
@@ -3,7 +3,9 @@ package sspak
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/axllent/ssbak/app"
 	"github.com/stretchr/testify/assert"
@@ -64,7 +66,7 @@ func TestSkipResampled(t *testing.T) {
 
 func TestAddAssetsAndLoadAssets(t *testing.T) {
 	app.IgnoreResampled = false
-	UseZSTD = false
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
 
 	// Source: a directory named "assets" with a few files
 	srcBase := t.TempDir()
@@ -94,7 +96,7 @@ func TestAddAssetsAndLoadAssets(t *testing.T) {
 
 func TestAddAssetsSkipsResampled(t *testing.T) {
 	app.IgnoreResampled = true
-	UseZSTD = false
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
 	defer func() { app.IgnoreResampled = false }()
 
 	srcBase := t.TempDir()
@@ -125,8 +127,8 @@ func TestAddAssetsEmptyDirectory(t *testing.T) {
 
 func TestAddAssetsZSTD(t *testing.T) {
 	app.IgnoreResampled = false
-	UseZSTD = true
-	defer func() { UseZSTD = false }()
+	Compression = CompressionOptions{Algorithm: CompressionZSTD}
+	defer func() { Compression = CompressionOptions{Algorithm: CompressionGzip} }()
 
 	srcBase := t.TempDir()
 	assetsDir := filepath.Join(srcBase, "assets")
@@ -147,3 +149,302 @@ func TestAddAssetsZSTD(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, []byte("zstd content"), got)
 }
+
+func TestLoadAssetsReplacesExisting(t *testing.T) {
+	resetAppState(t)
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	app.IgnoreResampled = false
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	srcBase := t.TempDir()
+	assetsDir := filepath.Join(srcBase, "assets")
+	require.NoError(t, os.MkdirAll(assetsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "new.jpg"), []byte("new"), 0644))
+
+	f := &File{TempFolder: t.TempDir()}
+	require.NoError(t, f.AddAssets(assetsDir))
+
+	destBase := t.TempDir()
+	existing := filepath.Join(destBase, "assets")
+	require.NoError(t, os.MkdirAll(existing, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(existing, "old.jpg"), []byte("old"), 0644))
+
+	require.NoError(t, f.LoadAssets(destBase))
+
+	assert.FileExists(t, filepath.Join(existing, "new.jpg"))
+	assert.NoFileExists(t, filepath.Join(existing, "old.jpg"))
+	assert.FileExists(t, filepath.Join(existing+".old", "old.jpg"), "old assets are scheduled for cleanup")
+
+	// no staging directories may be left behind
+	entries, err := os.ReadDir(destBase)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestLoadAssetsKeepOld(t *testing.T) {
+	resetAppState(t)
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	app.IgnoreResampled = false
+	app.KeepOldAssets = true
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+	defer func() { app.KeepOldAssets = false }()
+
+	srcBase := t.TempDir()
+	assetsDir := filepath.Join(srcBase, "assets")
+	require.NoError(t, os.MkdirAll(assetsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "new.jpg"), []byte("new"), 0644))
+
+	f := &File{TempFolder: t.TempDir()}
+	require.NoError(t, f.AddAssets(assetsDir))
+
+	destBase := t.TempDir()
+	existing := filepath.Join(destBase, "assets")
+	require.NoError(t, os.MkdirAll(existing, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(existing, "old.jpg"), []byte("old"), 0644))
+
+	require.NoError(t, f.LoadAssets(destBase))
+
+	kept, err := filepath.Glob(existing + ".old-*")
+	require.NoError(t, err)
+	require.Len(t, kept, 1)
+	assert.FileExists(t, filepath.Join(kept[0], "old.jpg"))
+	assert.FileExists(t, filepath.Join(existing, "new.jpg"))
+}
+
+func TestLoadAssetsFailureKeepsExisting(t *testing.T) {
+	resetAppState(t)
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	app.IgnoreResampled = false
+
+	// a corrupt archive
+	archive := filepath.Join(t.TempDir(), "assets.tar.gz")
+	require.NoError(t, os.WriteFile(archive, []byte("not a gzip file"), 0644))
+	f := &File{AssetsFile: archive}
+
+	destBase := t.TempDir()
+	existing := filepath.Join(destBase, "assets")
+	require.NoError(t, os.MkdirAll(existing, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(existing, "old.jpg"), []byte("old"), 0644))
+
+	assert.Error(t, f.LoadAssets(destBase))
+
+	assert.FileExists(t, filepath.Join(existing, "old.jpg"))
+	entries, err := os.ReadDir(destBase)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "the staging directory should be removed")
+}
+
+func TestMergeAssets(t *testing.T) {
+	app.IgnoreResampled = false
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	srcBase := t.TempDir()
+	assetsDir := filepath.Join(srcBase, "assets")
+	require.NoError(t, os.MkdirAll(assetsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "older.txt"), []byte("archived"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "newer.txt"), []byte("archived"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "missing.txt"), []byte("archived"), 0644))
+
+	f := &File{TempFolder: t.TempDir()}
+	require.NoError(t, f.AddAssets(assetsDir))
+
+	now := time.Now()
+
+	tests := []struct {
+		policy   ConflictPolicy
+		stats    ExtractStats
+		older    string
+		newerTxt string
+	}{
+		{ConflictSkip, ExtractStats{Added: 1, Skipped: 2}, "local", "local"},
+		{ConflictNewer, ExtractStats{Added: 1, Skipped: 1, Overwritten: 1}, "archived", "local"},
+		{ConflictOverwrite, ExtractStats{Added: 1, Overwritten: 2}, "archived", "archived"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			destBase := t.TempDir()
+			existing := filepath.Join(destBase, "assets")
+			require.NoError(t, os.MkdirAll(existing, 0755))
+			for name, mtime := range map[string]time.Time{
+				"older.txt": now.Add(-time.Hour),
+				"newer.txt": now.Add(time.Hour),
+				"local.txt": now,
+			} {
+				require.NoError(t, os.WriteFile(filepath.Join(existing, name), []byte("local"), 0644))
+				require.NoError(t, os.Chtimes(filepath.Join(existing, name), mtime, mtime))
+			}
+
+			stats, err := f.MergeAssets(destBase, tt.policy)
+			require.NoError(t, err)
+			assert.Equal(t, tt.stats, stats)
+
+			got, err := os.ReadFile(filepath.Join(existing, "older.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.older, string(got))
+
+			got, err = os.ReadFile(filepath.Join(existing, "newer.txt"))
+			require.NoError(t, err)
+			assert.Equal(t, tt.newerTxt, string(got))
+
+			// nothing is ever deleted
+			assert.FileExists(t, filepath.Join(existing, "local.txt"))
+			assert.FileExists(t, filepath.Join(existing, "missing.txt"))
+		})
+	}
+}
+
+func TestMergeAssetsSymlinkDestination(t *testing.T) {
+	app.IgnoreResampled = false
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	f := writeTestAssets(t, map[string]string{
+		"file.txt":     "archived",
+		"linked/a.txt": "archived",
+	})
+
+	outside := t.TempDir()
+	target := filepath.Join(outside, "target.txt")
+	require.NoError(t, os.WriteFile(target, []byte("outside"), 0644))
+
+	destBase := t.TempDir()
+	existing := filepath.Join(destBase, "assets")
+	require.NoError(t, os.MkdirAll(existing, 0755))
+	require.NoError(t, os.Symlink(target, filepath.Join(existing, "file.txt")))
+	require.NoError(t, os.Symlink(outside, filepath.Join(existing, "linked")))
+
+	stats, err := f.MergeAssets(destBase, ConflictOverwrite)
+	require.NoError(t, err)
+	assert.Equal(t, ExtractStats{Overwritten: 1}, stats)
+
+	// the symlink is replaced, its target is untouched
+	got, err := os.ReadFile(target)
+	require.NoError(t, err)
+	assert.Equal(t, "outside", string(got))
+
+	fi, err := os.Lstat(filepath.Join(existing, "file.txt"))
+	require.NoError(t, err)
+	assert.True(t, fi.Mode().IsRegular())
+
+	// nothing is written through a symlinked directory
+	assert.NoFileExists(t, filepath.Join(outside, "a.txt"))
+}
+
+func TestMergeAssetsNewDirectoryTimestamp(t *testing.T) {
+	app.IgnoreResampled = false
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	// age the archived directory so a restored timestamp would be detectable
+	old := time.Now().Add(-48 * time.Hour)
+	srcAssets := filepath.Join(t.TempDir(), "assets")
+	require.NoError(t, os.MkdirAll(filepath.Join(srcAssets, "new"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(srcAssets, "new", "a.txt"), []byte("archived"), 0644))
+	require.NoError(t, os.Chtimes(filepath.Join(srcAssets, "new"), old, old))
+	f := &File{TempFolder: t.TempDir()}
+	require.NoError(t, f.AddAssets(srcAssets))
+
+	destBase := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(destBase, "assets"), 0755))
+
+	_, err := f.MergeAssets(destBase, ConflictNewer)
+	require.NoError(t, err)
+
+	fi, err := os.Stat(filepath.Join(destBase, "assets", "new"))
+	require.NoError(t, err)
+	assert.True(t, fi.ModTime().After(old.Add(time.Hour)), "merged directories keep the merge time")
+}
+
+func TestParseConflictPolicy(t *testing.T) {
+	p, err := ParseConflictPolicy("Newer")
+	require.NoError(t, err)
+	assert.Equal(t, ConflictNewer, p)
+
+	_, err = ParseConflictPolicy("sometimes")
+	assert.Error(t, err)
+}
+
+// writeTestAssets creates an assets archive containing the given files (path: content)
+func writeTestAssets(t *testing.T, files map[string]string) *File {
+	t.Helper()
+
+	assetsDir := filepath.Join(t.TempDir(), "assets")
+	for name, content := range files {
+		p := filepath.Join(assetsDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+
+	f := &File{TempFolder: t.TempDir()}
+	require.NoError(t, f.AddAssets(assetsDir))
+
+	return f
+}
+
+func TestListAssets(t *testing.T) {
+	app.IgnoreResampled = false
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	f := writeTestAssets(t, map[string]string{
+		"Uploads/reports/q1.pdf": "q1",
+		"Uploads/reports/q2.pdf": "q2 report",
+		"Uploads/photo.jpg":      "jpeg",
+	})
+
+	entries, err := f.ListAssets(nil)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	entries, err = f.ListAssets([]string{"Uploads/reports/*.pdf"})
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "Uploads/reports/q1.pdf", entries[0].Name)
+	assert.Equal(t, int64(2), entries[0].Size)
+	assert.Equal(t, int64(9), entries[1].Size)
+	assert.False(t, entries[0].ModTime.IsZero())
+}
+
+func TestExtractAssetFiles(t *testing.T) {
+	app.IgnoreResampled = false
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	f := writeTestAssets(t, map[string]string{
+		"Uploads/reports/q1.pdf": "q1",
+		"Uploads/reports/q1.jpg": "jpeg",
+		"Uploads/photo.jpg":      "jpeg",
+	})
+
+	outDir := t.TempDir()
+	stats, err := f.ExtractAssetFiles(outDir, []string{"Uploads/reports/*.pdf"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Added)
+
+	assert.FileExists(t, filepath.Join(outDir, "assets", "Uploads", "reports", "q1.pdf"))
+	assert.NoFileExists(t, filepath.Join(outDir, "assets", "Uploads", "reports", "q1.jpg"))
+	assert.NoFileExists(t, filepath.Join(outDir, "assets", "Uploads", "photo.jpg"))
+}
+
+func TestAddAssetsUncompressed(t *testing.T) {
+	resetAppState(t)
+	Compression = CompressionOptions{Algorithm: CompressionGzip, Assets: CompressionAdaptive}
+	defer func() { Compression = CompressionOptions{Algorithm: CompressionGzip} }()
+
+	f := writeTestAssets(t, map[string]string{
+		"Uploads/photo.jpg": strings.Repeat("jpeg", 1000),
+		"Uploads/notes.txt": "notes",
+	})
+	assert.Equal(t, "assets.tar", filepath.Base(f.AssetsFile))
+
+	sspakPath := filepath.Join(t.TempDir(), "site.sspak")
+	require.NoError(t, f.Write(sspakPath))
+
+	archive, err := Probe(sspakPath)
+	require.NoError(t, err)
+	assert.Equal(t, "assets.tar", archive.AssetsFile)
+
+	webroot := t.TempDir()
+	require.NoError(t, archive.LoadAssets(webroot))
+
+	got, err := os.ReadFile(filepath.Join(webroot, "assets", "Uploads", "notes.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("notes"), got)
+}
@@ -0,0 +1,190 @@
+package sspak
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/utils"
+)
+
+// DefaultCodeExcludes are the gitignore-style patterns (see matchPattern)
+// excluded from code archives: the environment files (with the site's database
+// credentials), dependencies, assets, caches, the git repository and other
+// sspak files.
+var DefaultCodeExcludes = []string{
+	"/.env",
+	"/_ss_environment.php",
+	"/vendor",
+	"node_modules",
+	"/assets",
+	"/public/assets",
+	"silverstripe-cache",
+	".git",
+	"*.sspak",
+}
+
+// AddCode adds a code archive of the webroot, excluding files matching any of
+// the gitignore-style excludes (relative to the webroot). Symlinks are stored
+// as symlinks, and the archive is compressed according to Compression.
+func (f *File) AddCode(webroot string, excludes []string) error {
+	webroot, err := filepath.Abs(webroot)
+	if err != nil {
+		return err
+	}
+
+	if !utils.IsDir(webroot) {
+		return fmt.Errorf("'%s' is not a directory", webroot)
+	}
+
+	f.CodeFile = filepath.Join(f.TempFolder, "code.tar"+Compression.extension())
+
+	app.Log(fmt.Sprintf("Compressing code in '%s' to '%s' (excluding '%s')", webroot, f.CodeFile, strings.Join(excludes, "', '")))
+
+	file, err := os.Create(f.CodeFile)
+	if err != nil {
+		return err
+	}
+
+	compressor, err := Compression.newWriter(file)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	tarWriter := tar.NewWriter(compressor)
+
+	files, err := tarAddCode(webroot, excludes, tarWriter)
+	if err != nil {
+		_ = tarWriter.Close()
+		_ = compressor.Close()
+		_ = file.Close()
+		return err
+	}
+
+	if err = tarWriter.Close(); err != nil {
+		_ = compressor.Close()
+		_ = file.Close()
+		return err
+	}
+
+	if err = compressor.Close(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	outSize, _ := utils.CalcSize(f.CodeFile)
+	app.Log(fmt.Sprintf("Added %d code files (%s)", files, utils.ByteToHr(outSize)))
+
+	return file.Close()
+}
+
+// tarAddCode writes the contents of webroot to tarWriter with paths relative
+// to webroot, skipping anything matching excludes. It returns the number of files added.
+func tarAddCode(webroot string, excludes []string, tarWriter *tar.Writer) (int, error) {
+	files := 0
+
+	err := filepath.WalkDir(webroot, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(webroot, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if matchAny(excludes, rel) {
+			app.Log(fmt.Sprintf("Excluding '%s'", rel))
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		switch {
+		case info.Mode()&os.ModeSymlink != 0:
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		case !info.Mode().IsRegular() && !info.IsDir():
+			// sockets, devices etc
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = rel
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(filepath.Clean(p))
+		if err != nil {
+			return err
+		}
+		defer func() { _ = file.Close() }()
+
+		if _, err := io.Copy(tarWriter, file); err != nil {
+			return err
+		}
+		files++
+
+		return nil
+	})
+
+	return files, err
+}
+
+// LoadCode extracts the code archive into webroot, overwriting existing files
+// but leaving any other files (eg: excluded from the archive) untouched.
+func (f *File) LoadCode(webroot string) (ExtractStats, error) {
+	if f.CodeFile == "" {
+		return ExtractStats{}, errors.New("no code archive found")
+	}
+
+	r, cleanup, err := f.openEntry(f.CodeFile)
+	if err != nil {
+		return ExtractStats{}, err
+	}
+	defer cleanup()
+
+	app.Log(fmt.Sprintf("Unpacking '%s' to '%s'", f.CodeFile, webroot))
+
+	stats, err := extractAssetsFromReader(r, webroot, extractOptions{symlinks: true, keepResampled: true})
+	if err != nil {
+		return stats, err
+	}
+
+	app.Log(fmt.Sprintf("Restored code: %d added, %d overwritten", stats.Added, stats.Overwritten))
+
+	return stats, nil
+}
+
+// isCodeEntry returns whether name is a code file of an sspak archive,
+// eg: code.tar.gz, code.tar.zst or code.tar
+func isCodeEntry(name string) bool {
+	return name == "code.tar" || strings.HasPrefix(name, "code.tar.")
+}
@@ -0,0 +1,127 @@
+package sspak
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddAndLoadCode(t *testing.T) {
+	resetAppState(t)
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	webroot := t.TempDir()
+	for name, content := range map[string]string{
+		"composer.json":                   "{}",
+		".env":                            "SS_DATABASE_NAME=source",
+		"_ss_environment.php":             "<?php define('SS_DATABASE_NAME', 'source');",
+		"app/src/Page.php":                "<?php",
+		"themes/simple/assets/style.css":  "body {}",
+		"themes/simple/node_modules/x.js": "x",
+		"vendor/autoload.php":             "<?php",
+		"public/assets/Uploads/file.txt":  "content",
+		"public/index.php":                "<?php",
+		".git/HEAD":                       "ref: refs/heads/main",
+		"silverstripe-cache/cache.php":    "<?php",
+		"old.sspak":                       "sspak",
+		"app/_config/secret.yml":          "secret",
+	} {
+		p := filepath.Join(webroot, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+	require.NoError(t, os.Symlink("../themes/simple", filepath.Join(webroot, "public", "theme")))
+
+	f := &File{TempFolder: t.TempDir()}
+	f.DatabaseFile = writeCompressedSQL(t, f.TempFolder, testDump, false)
+	require.NoError(t, f.AddCode(webroot, append(DefaultCodeExcludes, "app/_config/secret.yml")))
+	assert.Equal(t, "code.tar.gz", filepath.Base(f.CodeFile))
+
+	sspakPath := filepath.Join(t.TempDir(), "test.sspak")
+	require.NoError(t, f.Write(sspakPath))
+
+	probed, err := Probe(sspakPath)
+	require.NoError(t, err)
+	assert.Equal(t, "code.tar.gz", probed.CodeFile)
+
+	restore := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(restore, "composer.json"), []byte("old"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(restore, "local.txt"), []byte("local"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(restore, ".env"), []byte("SS_DATABASE_NAME=local"), 0644))
+
+	stats, err := probed.LoadCode(restore)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Overwritten)
+
+	for _, name := range []string{"composer.json", "app/src/Page.php", "themes/simple/assets/style.css", "public/index.php", "local.txt"} {
+		assert.FileExists(t, filepath.Join(restore, filepath.FromSlash(name)))
+	}
+	for _, name := range []string{"_ss_environment.php", "vendor", "themes/simple/node_modules", "public/assets", ".git", "silverstripe-cache", "old.sspak", "app/_config/secret.yml"} {
+		assert.NoFileExists(t, filepath.Join(restore, filepath.FromSlash(name)))
+		assert.NoDirExists(t, filepath.Join(restore, filepath.FromSlash(name)))
+	}
+
+	data, err := os.ReadFile(filepath.Join(restore, "composer.json"))
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(data))
+
+	// the local environment file is never overwritten
+	data, err = os.ReadFile(filepath.Join(restore, ".env"))
+	require.NoError(t, err)
+	assert.Equal(t, "SS_DATABASE_NAME=local", string(data))
+
+	link, err := os.Readlink(filepath.Join(restore, "public", "theme"))
+	require.NoError(t, err)
+	assert.Equal(t, "../themes/simple", link)
+}
+
+func TestProbeWithoutCode(t *testing.T) {
+	resetAppState(t)
+
+	f := &File{TempFolder: t.TempDir()}
+	f.DatabaseFile = writeCompressedSQL(t, f.TempFolder, testDump, false)
+	sspakPath := filepath.Join(t.TempDir(), "test.sspak")
+	require.NoError(t, f.Write(sspakPath))
+
+	probed, err := Probe(sspakPath)
+	require.NoError(t, err)
+	assert.Equal(t, "", probed.CodeFile)
+
+	_, err = probed.LoadCode(t.TempDir())
+	assert.Error(t, err)
+}
+
+func TestLoadCodeSymlinkEscape(t *testing.T) {
+	resetAppState(t)
+
+	outside := t.TempDir()
+	tmpDir := t.TempDir()
+	codeFile := filepath.Join(tmpDir, "code.tar.gz")
+
+	file, err := os.Create(codeFile)
+	require.NoError(t, err)
+	gw := gzip.NewWriter(file)
+	tw := tar.NewWriter(gw)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeSymlink, Name: "escape", Linkname: outside, Mode: 0777}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "escape/evil.txt", Size: 4, Mode: 0644}))
+	_, err = tw.Write([]byte("evil"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	require.NoError(t, file.Close())
+
+	f := &File{CodeFile: codeFile, TempFolder: tmpDir}
+	stats, err := f.LoadCode(t.TempDir())
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(outside, "evil.txt"))
+	// only the symlink was written
+	assert.Equal(t, 1, stats.Added)
+	assert.Equal(t, 0, stats.Overwritten)
+}
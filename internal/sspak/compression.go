@@ -0,0 +1,361 @@
+package sspak
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/ulikunitz/xz"
+)
+
+// CompressionAlgorithm is the compression used for the database and assets files
+type CompressionAlgorithm string
+
+const (
+	// CompressionGzip is compatible with the legacy SSPak utility (default)
+	CompressionGzip CompressionAlgorithm = "gzip"
+
+	// CompressionZSTD is faster with better compression, but requires SSBak to extract
+	CompressionZSTD CompressionAlgorithm = "zstd"
+
+	// CompressionXZ has the best compression, but is slow and requires SSBak to extract
+	CompressionXZ CompressionAlgorithm = "xz"
+
+	// CompressionNone stores the files uncompressed
+	CompressionNone CompressionAlgorithm = "none"
+
+	// CompressionAdaptive stores the assets uncompressed when they consist mostly
+	// of already-compressed files (images, video, PDFs, archives etc), and
+	// otherwise uses the database compression. It is only valid for assets.
+	CompressionAdaptive CompressionAlgorithm = "adaptive"
+
+	// adaptiveIncompressibleRatio is the share of already-compressed file
+	// bytes from which adaptive compression stores the assets uncompressed
+	adaptiveIncompressibleRatio = 0.9
+)
+
+var (
+	// gzipMagic is the header of a gzip stream
+	gzipMagic = []byte{0x1f, 0x8b}
+
+	// zstdMagic is the header of a zstd frame
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	// xzMagic is the header of an xz stream
+	xzMagic = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+
+	// xzDictCaps are the dictionary sizes of the xz compression levels 1-9,
+	// matching the presets of the xz utility
+	xzDictCaps = []int{1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+)
+
+// CompressionOptions configures the compression of new database and assets files
+type CompressionOptions struct {
+	// Algorithm is the compression algorithm
+	Algorithm CompressionAlgorithm
+
+	// Level is the compression level (gzip 1-9, zstd 1-22, xz 1-9), or 0 for the
+	// default. The zstd encoder only has four levels (see zstd.EncoderLevelFromZstd):
+	// 1-2 fastest, 3-5 default, 6-9 better and 10-22 best compression. The xz
+	// levels only set the dictionary size (see xzDictCaps).
+	Level int
+
+	// Concurrency is the number of goroutines used by the zstd encoder and
+	// parallel gzip, or 0 to use all CPUs
+	Concurrency int
+
+	// ParallelGzip compresses gzip in parallel blocks, producing a standard gzip stream
+	ParallelGzip bool
+
+	// Assets is the compression algorithm of the assets file (including
+	// adaptive), or empty to use Algorithm
+	Assets CompressionAlgorithm
+}
+
+// Compression is the compression used for new database and assets files.
+// This is set using CLI flags. Anything other than gzip makes the output sspak
+// file incompatible with the official sspak tool.
+var Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+// ParseCompressionAlgorithm returns the CompressionAlgorithm for name
+func ParseCompressionAlgorithm(name string) (CompressionAlgorithm, error) {
+	switch c := CompressionAlgorithm(strings.ToLower(name)); c {
+	case CompressionGzip, CompressionZSTD, CompressionXZ, CompressionNone:
+		return c, nil
+	}
+
+	return "", fmt.Errorf("invalid compression '%s' (gzip, zstd, xz or none)", name)
+}
+
+// ParseAssetsCompressionAlgorithm returns the assets CompressionAlgorithm for
+// name, which may also be adaptive
+func ParseAssetsCompressionAlgorithm(name string) (CompressionAlgorithm, error) {
+	switch c := CompressionAlgorithm(strings.ToLower(name)); c {
+	case CompressionGzip, CompressionZSTD, CompressionXZ, CompressionNone, CompressionAdaptive:
+		return c, nil
+	}
+
+	return "", fmt.Errorf("invalid assets compression '%s' (gzip, zstd, xz, none or adaptive)", name)
+}
+
+// Validate returns an error if the options are not supported
+func (c CompressionOptions) Validate() error {
+	if _, err := ParseCompressionAlgorithm(string(c.Algorithm)); err != nil {
+		return err
+	}
+
+	if c.Assets != "" {
+		if _, err := ParseAssetsCompressionAlgorithm(string(c.Assets)); err != nil {
+			return err
+		}
+	}
+
+	if c.Concurrency < 0 {
+		return fmt.Errorf("invalid concurrency %d", c.Concurrency)
+	}
+
+	if c.Level == 0 {
+		return nil
+	}
+
+	switch c.Algorithm {
+	case CompressionZSTD:
+		if c.Level < 1 || c.Level > 22 {
+			return fmt.Errorf("invalid zstd compression level %d (1-22)", c.Level)
+		}
+	case CompressionGzip:
+		if c.Level < gzip.BestSpeed || c.Level > gzip.BestCompression {
+			return fmt.Errorf("invalid gzip compression level %d (1-9)", c.Level)
+		}
+	case CompressionXZ:
+		if c.Level < 1 || c.Level > len(xzDictCaps) {
+			return fmt.Errorf("invalid xz compression level %d (1-9)", c.Level)
+		}
+	case CompressionNone:
+		return fmt.Errorf("a compression level cannot be used without compression")
+	}
+
+	return nil
+}
+
+// extension returns the file extension of the compression, eg: ".gz"
+func (c CompressionOptions) extension() string {
+	switch c.Algorithm {
+	case CompressionZSTD:
+		return ".zst"
+	case CompressionXZ:
+		return ".xz"
+	case CompressionNone:
+		return ""
+	}
+
+	return ".gz"
+}
+
+// newWriter wraps w with the compressor. Closing the returned writer flushes
+// the compressor, but does not close w.
+func (c CompressionOptions) newWriter(w io.Writer) (io.WriteCloser, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	switch c.Algorithm {
+	case CompressionNone:
+		return nopWriteCloser{w}, nil
+
+	case CompressionZSTD:
+		opts := []zstd.EOption{}
+		if c.Level != 0 {
+			level := zstd.EncoderLevelFromZstd(c.Level)
+			app.Log(fmt.Sprintf("Using zstd encoder level '%s' for compression level %d", level, c.Level))
+			opts = append(opts, zstd.WithEncoderLevel(level))
+		}
+		if c.Concurrency != 0 {
+			opts = append(opts, zstd.WithEncoderConcurrency(c.Concurrency))
+		}
+
+		zstdWriter, err := zstd.NewWriter(w, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("error creating zstd writer: %s", err.Error())
+		}
+
+		return zstdWriter, nil
+
+	case CompressionXZ:
+		cfg := xz.WriterConfig{}
+		if c.Level != 0 {
+			cfg.DictCap = xzDictCaps[c.Level-1]
+		}
+
+		xzWriter, err := cfg.NewWriter(w)
+		if err != nil {
+			return nil, fmt.Errorf("error creating xz writer: %s", err.Error())
+		}
+
+		return xzWriter, nil
+	}
+
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	if c.ParallelGzip {
+		return newParallelGzipWriter(w, level, c.Concurrency)
+	}
+
+	gzipWriter, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return nil, fmt.Errorf("error creating gzip writer: %s", err.Error())
+	}
+
+	return gzipWriter, nil
+}
+
+// forAssets returns the options to compress an assets archive with, given the
+// sizes of its files. The compression level and parallel gzip only apply when
+// the assets use the same algorithm as the database.
+func (c CompressionOptions) forAssets(sizes assetsSizes) CompressionOptions {
+	algorithm := c.Assets
+	if algorithm == "" {
+		return c
+	}
+
+	if algorithm == CompressionAdaptive {
+		algorithm = c.Algorithm
+		if sizes.incompressibleRatio() >= adaptiveIncompressibleRatio {
+			algorithm = CompressionNone
+		}
+		app.Log(fmt.Sprintf("%.0f%% of the assets are already compressed, using %s compression", sizes.incompressibleRatio()*100, algorithm))
+	}
+
+	opts := CompressionOptions{Algorithm: algorithm, Concurrency: c.Concurrency}
+	if algorithm == c.Algorithm {
+		opts.Level = c.Level
+		opts.ParallelGzip = c.ParallelGzip
+	}
+
+	return opts
+}
+
+// assetsSizes tallies the sizes of asset files for adaptive compression
+type assetsSizes struct {
+	total          int64
+	incompressible int64
+}
+
+// incompressibleExtensions are file formats that are already compressed
+var incompressibleExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true, ".webp": true, ".avif": true, ".heic": true,
+	".mp4": true, ".m4v": true, ".mov": true, ".webm": true, ".mkv": true, ".avi": true,
+	".mp3": true, ".m4a": true, ".ogg": true, ".aac": true,
+	".pdf": true, ".zip": true, ".gz": true, ".tgz": true, ".bz2": true, ".xz": true, ".zst": true, ".7z": true, ".rar": true,
+	".docx": true, ".xlsx": true, ".pptx": true, ".odt": true, ".ods": true, ".woff": true, ".woff2": true,
+}
+
+// add adds a file to the tally
+func (s *assetsSizes) add(name string, size int64) {
+	s.total += size
+	if incompressibleExtensions[strings.ToLower(path.Ext(name))] {
+		s.incompressible += size
+	}
+}
+
+// incompressibleRatio returns the share of bytes in already-compressed files
+func (s assetsSizes) incompressibleRatio() float64 {
+	if s.total == 0 {
+		return 0
+	}
+
+	return float64(s.incompressible) / float64(s.total)
+}
+
+// nopWriteCloser adds a no-op Close to an io.Writer
+type nopWriteCloser struct {
+	io.Writer
+}
+
+// Close does nothing
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// newDecompressReader wraps r with a decompressor detected from the magic bytes
+// of the stream (gzip, zstd or xz). Anything else is assumed to be uncompressed.
+func newDecompressReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+
+	// a short (or empty) stream is not an error, it is simply not compressed
+	magic, _ := br.Peek(len(xzMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, zstdMagic):
+		zstdDecoder, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("error creating zstd reader: %s", err.Error())
+		}
+
+		return zstdDecoder.IOReadCloser(), nil
+
+	case bytes.HasPrefix(magic, gzipMagic):
+		gzipReader, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("error creating gzip reader: %s", err.Error())
+		}
+
+		return gzipReader, nil
+
+	case bytes.HasPrefix(magic, xzMagic):
+		xzReader, err := xz.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("error creating xz reader: %s", err.Error())
+		}
+
+		return io.NopCloser(xzReader), nil
+	}
+
+	return io.NopCloser(br), nil
+}
+
+// isDatabaseEntry returns whether name is a database file of an sspak archive,
+// eg: database.sql.gz, database.sql.zst or database.sql
+func isDatabaseEntry(name string) bool {
+	return name == "database.sql" || strings.HasPrefix(name, "database.sql.")
+}
+
+// isAssetsEntry returns whether name is an assets file of an sspak archive,
+// eg: assets.tar.gz, assets.tar.zst or assets.tar
+func isAssetsEntry(name string) bool {
+	return name == "assets.tar" || strings.HasPrefix(name, "assets.tar.")
+}
+
+// parallelGzipBlockSize is the size of the blocks compressed concurrently
+const parallelGzipBlockSize = 1 << 20
+
+// newParallelGzipWriter returns a gzip writer compressing blocks at level using
+// concurrency goroutines (0 to use all CPUs). The blocks form a single standard
+// gzip stream.
+func newParallelGzipWriter(w io.Writer, level, concurrency int) (io.WriteCloser, error) {
+	if concurrency == 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+
+	gzipWriter, err := pgzip.NewWriterLevel(w, level)
+	if err != nil {
+		return nil, fmt.Errorf("error creating gzip writer: %s", err.Error())
+	}
+
+	if err := gzipWriter.SetConcurrency(parallelGzipBlockSize, concurrency); err != nil {
+		return nil, fmt.Errorf("error creating gzip writer: %s", err.Error())
+	}
+
+	return gzipWriter, nil
+}
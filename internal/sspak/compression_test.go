@@ -0,0 +1,176 @@
+package sspak
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCompressionAlgorithm(t *testing.T) {
+	for name, want := range map[string]CompressionAlgorithm{
+		"gzip": CompressionGzip,
+		"ZSTD": CompressionZSTD,
+		"none": CompressionNone,
+		"xz":   CompressionXZ,
+	} {
+		got, err := ParseCompressionAlgorithm(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	_, err := ParseCompressionAlgorithm("bzip2")
+	assert.Error(t, err)
+}
+
+func TestCompressionOptionsValidate(t *testing.T) {
+	assert.NoError(t, CompressionOptions{Algorithm: CompressionGzip}.Validate())
+	assert.NoError(t, CompressionOptions{Algorithm: CompressionGzip, Level: 9}.Validate())
+	assert.Error(t, CompressionOptions{Algorithm: CompressionGzip, Level: 10}.Validate())
+	assert.NoError(t, CompressionOptions{Algorithm: CompressionZSTD, Level: 22}.Validate())
+	assert.Error(t, CompressionOptions{Algorithm: CompressionZSTD, Level: 23}.Validate())
+	assert.Error(t, CompressionOptions{Algorithm: CompressionZSTD, Level: -1}.Validate())
+	assert.Error(t, CompressionOptions{Algorithm: CompressionNone, Level: 1}.Validate())
+	assert.Error(t, CompressionOptions{Algorithm: CompressionZSTD, Concurrency: -1}.Validate())
+	assert.NoError(t, CompressionOptions{Algorithm: CompressionXZ, Level: 9}.Validate())
+	assert.Error(t, CompressionOptions{Algorithm: CompressionXZ, Level: 10}.Validate())
+	assert.Error(t, CompressionOptions{Algorithm: "bzip2"}.Validate())
+}
+
+func TestCompressionRoundtrip(t *testing.T) {
+	data := bytes.Repeat([]byte("INSERT INTO `SiteTree` VALUES (1,'Page');\n"), 100000)
+
+	for _, opts := range []CompressionOptions{
+		{Algorithm: CompressionGzip},
+		{Algorithm: CompressionGzip, Level: 1},
+		{Algorithm: CompressionGzip, ParallelGzip: true, Concurrency: 3},
+		{Algorithm: CompressionZSTD},
+		{Algorithm: CompressionZSTD, Level: 19, Concurrency: 2},
+		{Algorithm: CompressionXZ},
+		{Algorithm: CompressionXZ, Level: 1},
+		{Algorithm: CompressionNone},
+	} {
+		t.Run(fmt.Sprintf("%+v", opts), func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := opts.newWriter(&buf)
+			require.NoError(t, err)
+			_, err = w.Write(data)
+			require.NoError(t, err)
+			require.NoError(t, w.Close())
+
+			if opts.Algorithm == CompressionNone {
+				assert.Equal(t, data, buf.Bytes())
+			} else {
+				assert.Less(t, buf.Len(), len(data))
+			}
+
+			r, err := newDecompressReader(&buf)
+			require.NoError(t, err)
+			got, err := io.ReadAll(r)
+			require.NoError(t, err)
+			require.NoError(t, r.Close())
+			assert.Equal(t, data, got)
+		})
+	}
+}
+
+func TestParallelGzipIsStandardGzip(t *testing.T) {
+	// several blocks, with a partial final block
+	data := make([]byte, parallelGzipBlockSize*3+12345)
+	for i := range data {
+		data[i] = byte(i * 7 % 251)
+	}
+
+	var buf bytes.Buffer
+	w, err := newParallelGzipWriter(&buf, gzip.DefaultCompression, 4)
+	require.NoError(t, err)
+	// write in uneven chunks to cross block boundaries
+	for i := 0; i < len(data); i += 100000 {
+		_, err := w.Write(data[i:min(i+100000, len(data))])
+		require.NoError(t, err)
+	}
+	require.NoError(t, w.Close())
+
+	r, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	r.Multistream(false)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+}
+
+func TestParallelGzipEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newParallelGzipWriter(&buf, gzip.DefaultCompression, 0)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	r, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestParallelGzipCloseTwice(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := newParallelGzipWriter(&buf, gzip.DefaultCompression, 2)
+	require.NoError(t, err)
+	_, err = w.Write([]byte("hello world"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	size := buf.Len()
+	require.NoError(t, w.Close())
+	assert.Equal(t, size, buf.Len())
+
+	r, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(got))
+}
+
+func TestDecompressReaderEmpty(t *testing.T) {
+	r, err := newDecompressReader(bytes.NewReader(nil))
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestSSPakEntryNames(t *testing.T) {
+	for _, name := range []string{"database.sql", "database.sql.gz", "database.sql.zst", "database.sql.xz"} {
+		assert.True(t, isDatabaseEntry(name), name)
+		assert.False(t, isAssetsEntry(name), name)
+	}
+	for _, name := range []string{"assets.tar", "assets.tar.gz", "assets.tar.zst", "assets.tar.xz"} {
+		assert.True(t, isAssetsEntry(name), name)
+		assert.False(t, isDatabaseEntry(name), name)
+	}
+	assert.False(t, isDatabaseEntry("database.sqlite"))
+	assert.False(t, isAssetsEntry("assets.tarball"))
+}
+
+func TestCompressionOptionsForAssets(t *testing.T) {
+	var media, text assetsSizes
+	media.add("photo.JPG", 9500)
+	media.add("notes.txt", 500)
+	text.add("photo.jpg", 5000)
+	text.add("styles.css", 5000)
+
+	opts := CompressionOptions{Algorithm: CompressionZSTD, Level: 19}
+	assert.Equal(t, opts, opts.forAssets(media))
+
+	opts.Assets = CompressionAdaptive
+	assert.Equal(t, CompressionNone, opts.forAssets(media).Algorithm)
+	assert.Equal(t, 0, opts.forAssets(media).Level)
+	assert.Equal(t, CompressionOptions{Algorithm: CompressionZSTD, Level: 19}, opts.forAssets(text))
+
+	opts.Assets = CompressionGzip
+	assert.Equal(t, CompressionOptions{Algorithm: CompressionGzip}, opts.forAssets(text))
+	assert.NoError(t, opts.forAssets(text).Validate())
+}
@@ -0,0 +1,232 @@
+package sspak
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/utils"
+)
+
+// Convert recompresses the database and assets of the sspak inFile according
+// to compression, and writes the result to outFile. Each entry is streamed through decompression and recompression
+// without extracting the archive. Resampled images are dropped when
+// app.IgnoreResampled is set, and only tables matching app.Tables are kept when set.
+func Convert(inFile, outFile string, compression CompressionOptions) error {
+	if err := compression.Validate(); err != nil {
+		return err
+	}
+
+	inAbs, _ := filepath.Abs(inFile)
+	outAbs, _ := filepath.Abs(outFile)
+	if inAbs == outAbs {
+		return errors.New("the input and output files must be different")
+	}
+
+	in, err := Probe(inFile)
+	if err != nil {
+		return err
+	}
+
+	if in.DatabaseFile == "" && in.AssetsFile == "" {
+		return fmt.Errorf("'%s' does not contain a database or assets", inFile)
+	}
+
+	if len(app.Tables) > 0 && in.DatabaseFile == "" {
+		return fmt.Errorf("'%s' does not contain a database", inFile)
+	}
+
+	out := &File{TempFolder: filepath.Join(app.GetTempDir(), "convert")}
+	if err := os.MkdirAll(out.TempFolder, 0750); err != nil {
+		return err
+	}
+
+	if in.DatabaseFile != "" {
+		if err := out.convertDatabase(in, compression); err != nil {
+			return err
+		}
+	}
+
+	if in.AssetsFile != "" {
+		if err := out.convertAssets(in, compression); err != nil {
+			return err
+		}
+	}
+
+	// the protected assets, additional directories, code & git-remote are copied as-is
+	out.sources = map[string]string{}
+	for _, entry := range []string{in.ProtectedAssetsFile, in.DirectoriesFile, in.CodeFile, in.GitRemoteFile} {
+		if entry != "" {
+			out.sources[entry] = in.SourceSSPak
+		}
+	}
+	out.ProtectedAssetsFile, out.DirectoriesFile = in.ProtectedAssetsFile, in.DirectoriesFile
+	out.CodeFile, out.GitRemoteFile = in.CodeFile, in.GitRemoteFile
+
+	return out.Write(outFile)
+}
+
+// convertDatabase recompresses the database of in to the temp folder of f,
+// keeping only the tables matching app.Tables when set.
+func (f *File) convertDatabase(in *File, compression CompressionOptions) error {
+	reader, err := in.openDatabaseReader()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	f.DatabaseFile = filepath.Join(f.TempFolder, "database.sql"+compression.extension())
+
+	app.Log(fmt.Sprintf("Converting '%s' to '%s'", in.DatabaseFile, f.DatabaseFile))
+
+	file, err := os.Create(f.DatabaseFile)
+	if err != nil {
+		return err
+	}
+
+	compressor, err := compression.newWriter(file)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	filter := newTableFilter(app.Tables, "")
+	if filter == nil {
+		_, err = io.Copy(compressor, reader)
+	} else {
+		app.Log(fmt.Sprintf("Only keeping tables matching '%s'", strings.Join(app.Tables, "', '")))
+		var tables []string
+		tables, err = filterStatements(reader, compressor, filter)
+		if err == nil && len(tables) == 0 {
+			err = fmt.Errorf("no tables matching '%s' found in '%s'", strings.Join(app.Tables, "', '"), in.DatabaseFile)
+		}
+	}
+
+	if err != nil {
+		_ = compressor.Close()
+		_ = file.Close()
+		return err
+	}
+
+	if err := compressor.Close(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	outSize, _ := utils.CalcSize(f.DatabaseFile)
+	app.Log(fmt.Sprintf("Wrote '%s' (%s)", f.DatabaseFile, utils.ByteToHr(outSize)))
+
+	return file.Close()
+}
+
+// convertAssets recompresses the assets of in to the temp folder of f,
+// dropping resampled images when app.IgnoreResampled is set.
+func (f *File) convertAssets(in *File, compression CompressionOptions) error {
+	rawReader, cleanup, err := in.openEntry(in.AssetsFile)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	reader, err := newDecompressReader(rawReader)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	var sizes assetsSizes
+	if compression.Assets == CompressionAdaptive {
+		entries, err := in.ListAssets(nil)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if !skipResampled("/" + e.Name) {
+				sizes.add(e.Name, e.Size)
+			}
+		}
+	}
+
+	compression = compression.forAssets(sizes)
+
+	f.AssetsFile = filepath.Join(f.TempFolder, "assets.tar"+compression.extension())
+
+	app.Log(fmt.Sprintf("Converting '%s' to '%s'", in.AssetsFile, f.AssetsFile))
+
+	if app.IgnoreResampled {
+		app.Log("Ignoring resampled images")
+	}
+
+	file, err := os.Create(f.AssetsFile)
+	if err != nil {
+		return err
+	}
+
+	compressor, err := compression.newWriter(file)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	tarWriter := tar.NewWriter(compressor)
+	skipped, err := copyTar(tar.NewReader(reader), tarWriter)
+	if err == nil {
+		// Close tarWriter first to ensure all data is flushed to the compressor
+		err = tarWriter.Close()
+	}
+
+	if err != nil {
+		_ = compressor.Close()
+		_ = file.Close()
+		return err
+	}
+
+	if err := compressor.Close(); err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	if skipped > 0 {
+		app.Log(fmt.Sprintf("Dropped %d resampled images", skipped))
+	}
+
+	outSize, _ := utils.CalcSize(f.AssetsFile)
+	app.Log(fmt.Sprintf("Wrote '%s' (%s)", f.AssetsFile, utils.ByteToHr(outSize)))
+
+	return file.Close()
+}
+
+// copyTar copies all entries from tr to tw, skipping resampled images, and
+// returns the number of skipped entries.
+func copyTar(tr *tar.Reader, tw *tar.Writer) (int, error) {
+	skipped := 0
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return skipped, nil
+		}
+		if err != nil {
+			return skipped, err
+		}
+
+		if header.Typeflag == tar.TypeReg && skipResampled(header.Name) {
+			skipped++
+			continue
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return skipped, err
+		}
+
+		/* #nosec - file is streamed from sspak archive */
+		if _, err := io.Copy(tw, tr); err != nil {
+			return skipped, err
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package sspak
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert(t *testing.T) {
+	resetAppState(t)
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	f := writeTestAssets(t, map[string]string{
+		"Uploads/file.txt":                  "content",
+		"Uploads/photo__FillWzgwLDgwXQ.jpg": "resampled",
+	})
+	f.DatabaseFile = writeCompressedSQL(t, f.TempFolder, testDump, false)
+
+	inPath := filepath.Join(t.TempDir(), "in.sspak")
+	require.NoError(t, f.Write(inPath))
+
+	app.IgnoreResampled = true
+	app.Tables = []string{"Member"}
+	defer func() { app.IgnoreResampled, app.Tables = false, nil }()
+
+	outPath := filepath.Join(t.TempDir(), "out.sspak")
+	require.NoError(t, Convert(inPath, outPath, CompressionOptions{Algorithm: CompressionZSTD, Level: 19}))
+
+	out, err := Probe(outPath)
+	require.NoError(t, err)
+	assert.Equal(t, "database.sql.zst", out.DatabaseFile)
+	assert.Equal(t, "assets.tar.zst", out.AssetsFile)
+
+	app.IgnoreResampled = false
+	entries, err := out.ListAssets(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "Uploads/file.txt", entries[0].Name)
+
+	reader, err := out.openDatabaseReader()
+	require.NoError(t, err)
+	defer func() { _ = reader.Close() }()
+	tables, err := dumpTables(reader)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Member"}, tables)
+}
+
+func TestConvertSameFile(t *testing.T) {
+	err := Convert("site.sspak", "./site.sspak", CompressionOptions{Algorithm: CompressionGzip})
+	require.Error(t, err)
+	assert.True(t, strings.Contains(err.Error(), "must be different"))
+}
@@ -0,0 +1,286 @@
+package sspak
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+)
+
+var (
+	// autoIncrementRegex matches the AUTO_INCREMENT table option, which changes with every insert
+	autoIncrementRegex = regexp.MustCompile(`(?i)\s+AUTO_INCREMENT=\d+`)
+
+	// schemaSpaceRegex matches whitespace around brackets and commas in a schema
+	schemaSpaceRegex = regexp.MustCompile(`\s*([(),])\s*`)
+
+	// valuesRegex matches the VALUES keyword of an INSERT statement
+	valuesRegex = regexp.MustCompile(`(?i)\bVALUES\b`)
+)
+
+// Snapshot summarises the assets and database tables of an archive (or live
+// site) so that they can be compared.
+type Snapshot struct {
+	// Name describes the source of the snapshot, eg: the sspak file
+	Name string
+
+	// HasAssets is whether the source contains assets
+	HasAssets bool
+
+	// Assets maps asset paths (relative to the assets directory) to their summaries
+	Assets map[string]AssetSummary
+
+	// HasDatabase is whether the source contains a database
+	HasDatabase bool
+
+	// Tables maps table names to their summaries
+	Tables map[string]TableSummary
+}
+
+// AssetSummary is the size and (optional) hash of an asset file
+type AssetSummary struct {
+	Size int64
+
+	// Hash is the hex-encoded SHA-256 of the file, or empty if not calculated
+	Hash string
+}
+
+// TableSummary is the row count and schema of a database table
+type TableSummary struct {
+	Rows int64
+
+	// Schema is the normalised CREATE TABLE statement
+	Schema string
+}
+
+// Diff is the difference between two snapshots
+type Diff struct {
+	AssetsAdded   []string
+	AssetsRemoved []string
+	AssetsChanged []string
+
+	TablesAdded   []string
+	TablesRemoved []string
+	TablesChanged []string
+}
+
+// Empty returns whether there are no differences
+func (d *Diff) Empty() bool {
+	return len(d.AssetsAdded)+len(d.AssetsRemoved)+len(d.AssetsChanged)+
+		len(d.TablesAdded)+len(d.TablesRemoved)+len(d.TablesChanged) == 0
+}
+
+// Snapshot summarises the assets and database of f, streamed from the archive.
+// Asset files are hashed when withHashes is set, otherwise only compared by size.
+// The database and assets are skipped when app.OnlyAssets or app.OnlyDB are set.
+func (f *File) Snapshot(withHashes bool) (*Snapshot, error) {
+	s := &Snapshot{
+		Name:   f.SourceSSPak,
+		Assets: map[string]AssetSummary{},
+		Tables: map[string]TableSummary{},
+	}
+
+	if f.AssetsFile != "" && !app.OnlyDB {
+		s.HasAssets = true
+		if err := f.snapshotAssets(s, withHashes); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.DatabaseFile != "" && !app.OnlyAssets {
+		s.HasDatabase = true
+		if err := f.snapshotDatabase(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// snapshotAssets adds the asset files of f to s
+func (f *File) snapshotAssets(s *Snapshot, withHashes bool) error {
+	app.Log(fmt.Sprintf("Reading assets from '%s'", f.AssetsFile))
+
+	rawReader, cleanup, err := f.openEntry(f.AssetsFile)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	reader, err := newDecompressReader(rawReader)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		summary := AssetSummary{Size: header.Size}
+		if withHashes {
+			if summary.Hash, err = hashReader(tarReader); err != nil {
+				return err
+			}
+		}
+
+		s.Assets[assetsRelativePath(header.Name)] = summary
+	}
+}
+
+// snapshotDatabase adds the tables of the SQL dump of f to s
+func (f *File) snapshotDatabase(s *Snapshot) error {
+	app.Log(fmt.Sprintf("Reading database from '%s'", f.DatabaseFile))
+
+	reader, err := f.openDatabaseReader()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	return scanStatements(reader, func(stmt string) error {
+		m := tableStatementRegex.FindStringSubmatch(stmt)
+		if m == nil {
+			return nil
+		}
+
+		prefix := strings.ToUpper(strings.Join(strings.Fields(m[1]), " "))
+		table := s.Tables[m[2]]
+
+		switch {
+		case strings.HasPrefix(prefix, "CREATE TABLE"):
+			table.Schema = normaliseSchema(stmt)
+		case strings.HasPrefix(prefix, "INSERT"), strings.HasPrefix(prefix, "REPLACE"):
+			table.Rows += countInsertRows(stmt)
+		case strings.HasPrefix(prefix, "DROP TABLE"):
+			// tables are created after being dropped
+		default:
+			return nil
+		}
+
+		s.Tables[m[2]] = table
+
+		return nil
+	})
+}
+
+// hashReader returns the hex-encoded SHA-256 of the contents of r
+func hashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+
+	/* #nosec - file is streamed from sspak archive */
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// normaliseSchema returns a CREATE TABLE statement without the AUTO_INCREMENT
+// value, whitespace differences or a trailing semicolon
+func normaliseSchema(stmt string) string {
+	stmt = autoIncrementRegex.ReplaceAllString(stmt, "")
+	stmt = schemaSpaceRegex.ReplaceAllString(stmt, "$1")
+
+	return strings.TrimSuffix(strings.Join(strings.Fields(stmt), " "), ";")
+}
+
+// countInsertRows returns the number of rows inserted by an INSERT statement,
+// ie: the number of top-level value tuples, ignoring brackets within strings.
+func countInsertRows(stmt string) int64 {
+	loc := valuesRegex.FindStringIndex(stmt)
+	if loc == nil {
+		return 0
+	}
+
+	var (
+		rows    int64
+		depth   int
+		quote   byte
+		escaped bool
+	)
+
+	for _, c := range []byte(stmt[loc[1]:]) {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if c == '\\' {
+				escaped = true
+			} else if c == quote {
+				// a doubled quote closes and reopens the string, which is equivalent
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '(':
+			if depth == 0 {
+				rows++
+			}
+			depth++
+		case c == ')':
+			depth--
+		}
+	}
+
+	return rows
+}
+
+// Compare returns the differences from snapshot a to snapshot b. Assets or
+// tables are only compared when both snapshots contain them.
+func Compare(a, b *Snapshot) *Diff {
+	d := &Diff{}
+
+	if a.HasAssets && b.HasAssets {
+		d.AssetsAdded, d.AssetsRemoved, d.AssetsChanged = compareKeys(a.Assets, b.Assets, func(x, y AssetSummary) bool {
+			return x.Size != y.Size || (x.Hash != "" && y.Hash != "" && x.Hash != y.Hash)
+		})
+	}
+
+	if a.HasDatabase && b.HasDatabase {
+		d.TablesAdded, d.TablesRemoved, d.TablesChanged = compareKeys(a.Tables, b.Tables, func(x, y TableSummary) bool {
+			return x.Rows != y.Rows || x.Schema != y.Schema
+		})
+	}
+
+	return d
+}
+
+// compareKeys returns the sorted keys added to, removed from and changed in b compared to a
+func compareKeys[T any](a, b map[string]T, changed func(x, y T) bool) (added, removed, modified []string) {
+	for k, x := range a {
+		if y, ok := b[k]; !ok {
+			removed = append(removed, k)
+		} else if changed(x, y) {
+			modified = append(modified, k)
+		}
+	}
+
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			added = append(added, k)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(modified)
+
+	return added, removed, modified
+}
@@ -0,0 +1,131 @@
+package sspak
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// LiveSnapshot summarises the live assets in assetsDir (when withAssets is set)
+// and the live database configured in app.DB (when withDatabase is set), so that
+// they can be compared to an archive. A missing assets directory or database is
+// treated as empty. Asset files are hashed when withHashes is set.
+func LiveSnapshot(name, assetsDir string, withAssets, withDatabase, withHashes bool) (*Snapshot, error) {
+	s := &Snapshot{
+		Name:        name,
+		HasAssets:   withAssets,
+		Assets:      map[string]AssetSummary{},
+		HasDatabase: withDatabase,
+		Tables:      map[string]TableSummary{},
+	}
+
+	if withAssets && IsDir(assetsDir) {
+		if err := snapshotLiveAssets(s, assetsDir, withHashes); err != nil {
+			return nil, err
+		}
+	}
+
+	if withDatabase {
+		if err := snapshotLiveDatabase(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// snapshotLiveAssets adds the files in assetsDir to s
+func snapshotLiveAssets(s *Snapshot, assetsDir string, withHashes bool) error {
+	app.Log(fmt.Sprintf("Reading assets from '%s'", assetsDir))
+
+	return filepath.WalkDir(assetsDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(assetsDir, p)
+		if err != nil {
+			return err
+		}
+
+		summary := AssetSummary{Size: info.Size()}
+		if withHashes {
+			file, err := os.Open(filepath.Clean(p))
+			if err != nil {
+				return err
+			}
+			summary.Hash, err = hashReader(file)
+			_ = file.Close()
+			if err != nil {
+				return err
+			}
+		}
+
+		s.Assets[filepath.ToSlash(rel)] = summary
+
+		return nil
+	})
+}
+
+// snapshotLiveDatabase adds the row counts and schemas of the tables of the live database to s
+func snapshotLiveDatabase(s *Snapshot) error {
+	config := genMySQLConfig()
+	config.DBName = ""
+
+	db, err := sql.Open("mysql", config.FormatDSN())
+	if err != nil {
+		return fmt.Errorf("error opening database connection: %s", err.Error())
+	}
+	defer func() { _ = db.Close() }()
+
+	exists, err := databaseExists(db, app.DB.Name)
+	if err != nil || !exists {
+		return err
+	}
+
+	app.Log(fmt.Sprintf("Reading database '%s'", app.DB.Name))
+
+	rows, err := db.Query("SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = 'BASE TABLE'", app.DB.Name)
+	if err != nil {
+		return err
+	}
+
+	tables := []string{}
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		tables = append(tables, t)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, t := range tables {
+		var table TableSummary
+		if err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM `%s`.`%s`", app.DB.Name, t)).Scan(&table.Rows); err != nil {
+			return err
+		}
+
+		var name, schema string
+		if err := db.QueryRow(fmt.Sprintf("SHOW CREATE TABLE `%s`.`%s`", app.DB.Name, t)).Scan(&name, &schema); err != nil {
+			return err
+		}
+		table.Schema = normaliseSchema(schema)
+
+		s.Tables[t] = table
+	}
+
+	return nil
+}
@@ -0,0 +1,111 @@
+package sspak
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCountInsertRows(t *testing.T) {
+	assert.Equal(t, int64(2), countInsertRows("INSERT INTO `Member` VALUES (1,'a@example.com'),(2,'b@example.com');"))
+	assert.Equal(t, int64(1), countInsertRows("INSERT INTO `Page` (`ID`, `Title`) VALUES (1,'Brackets (), quotes \\' and '' (2,3)');"))
+	assert.Equal(t, int64(3), countInsertRows("INSERT INTO `T` VALUES\n(1),\n(2),\n(3);"))
+	assert.Equal(t, int64(0), countInsertRows("LOCK TABLES `T` WRITE;"))
+}
+
+func TestNormaliseSchema(t *testing.T) {
+	assert.Equal(t,
+		"CREATE TABLE `T`(`ID` int)ENGINE=InnoDB DEFAULT CHARSET=utf8mb4",
+		normaliseSchema("CREATE TABLE `T` (\n  `ID` int\n) ENGINE=InnoDB AUTO_INCREMENT=42 DEFAULT CHARSET=utf8mb4;"),
+	)
+}
+
+func TestArchiveSnapshotAndCompare(t *testing.T) {
+	resetAppState(t)
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	write := func(files map[string]string, dump string) *Snapshot {
+		f := writeTestAssets(t, files)
+		f.DatabaseFile = writeCompressedSQL(t, f.TempFolder, dump, false)
+		sspakPath := filepath.Join(t.TempDir(), "site.sspak")
+		require.NoError(t, f.Write(sspakPath))
+
+		archive, err := Probe(sspakPath)
+		require.NoError(t, err)
+		s, err := archive.Snapshot(true)
+		require.NoError(t, err)
+		return s
+	}
+
+	a := write(map[string]string{
+		"Uploads/same.txt":    "same",
+		"Uploads/changed.txt": "abc",
+		"Uploads/removed.txt": "gone",
+	}, testDump)
+
+	b := write(map[string]string{
+		"Uploads/same.txt":    "same",
+		"Uploads/changed.txt": "xyz",
+		"Uploads/added.txt":   "new",
+	}, strings.Replace(testDump, "(2,'b@example.com')", "(2,'b@example.com'),(3,'c@example.com')", 1)+
+		"CREATE TABLE `File` (\n  `ID` int NOT NULL\n);\n")
+
+	assert.Equal(t, TableSummary{Rows: 2, Schema: "CREATE TABLE `Member`(`ID` int NOT NULL,`Email` varchar(255))"}, a.Tables["Member"])
+	assert.Equal(t, int64(1), a.Tables["SiteTree"].Rows)
+	assert.Len(t, a.Assets["Uploads/same.txt"].Hash, 64)
+
+	d := Compare(a, b)
+	assert.Equal(t, []string{"Uploads/added.txt"}, d.AssetsAdded)
+	assert.Equal(t, []string{"Uploads/removed.txt"}, d.AssetsRemoved)
+	// same size, different hash
+	assert.Equal(t, []string{"Uploads/changed.txt"}, d.AssetsChanged)
+	assert.Equal(t, []string{"File"}, d.TablesAdded)
+	assert.Empty(t, d.TablesRemoved)
+	assert.Equal(t, []string{"Member"}, d.TablesChanged)
+	assert.False(t, d.Empty())
+
+	assert.True(t, Compare(a, a).Empty())
+}
+
+func TestLiveSnapshotAssets(t *testing.T) {
+	resetAppState(t)
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	f := writeTestAssets(t, map[string]string{
+		"Uploads/same.txt":    "same",
+		"Uploads/changed.txt": "abc",
+	})
+	sspakPath := filepath.Join(t.TempDir(), "site.sspak")
+	require.NoError(t, f.Write(sspakPath))
+	archive, err := Probe(sspakPath)
+	require.NoError(t, err)
+	a, err := archive.Snapshot(true)
+	require.NoError(t, err)
+
+	assetsDir := filepath.Join(t.TempDir(), "assets")
+	require.NoError(t, os.MkdirAll(filepath.Join(assetsDir, "Uploads"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "Uploads", "same.txt"), []byte("same"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "Uploads", "changed.txt"), []byte("xyz"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "Uploads", "added.txt"), []byte("new"), 0644))
+
+	live, err := LiveSnapshot("webroot", assetsDir, true, false, true)
+	require.NoError(t, err)
+	assert.Equal(t, a.Assets["Uploads/same.txt"], live.Assets["Uploads/same.txt"])
+
+	d := Compare(a, live)
+	assert.Equal(t, []string{"Uploads/added.txt"}, d.AssetsAdded)
+	assert.Equal(t, []string{"Uploads/changed.txt"}, d.AssetsChanged)
+	assert.Empty(t, d.TablesAdded, "the database is not compared")
+
+	// a missing assets directory is empty
+	live, err = LiveSnapshot("webroot", filepath.Join(t.TempDir(), "missing"), true, false, true)
+	require.NoError(t, err)
+	assert.Len(t, Compare(a, live).AssetsRemoved, 2)
+}
@@ -0,0 +1,310 @@
+package sspak
+
+import (
+	"archive/tar"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/utils"
+)
+
+// DatabasePlan describes what LoadDatabase (or LoadDatabaseAtomic) would do to
+// the target database
+type DatabasePlan struct {
+	// Host is the database server (including port if set)
+	Host string
+
+	// Name is the target database name
+	Name string
+
+	// Exists is whether the target database already exists
+	Exists bool
+
+	// ExistingTables are the tables currently in the target database
+	ExistingTables []string
+
+	// CreateTables are tables in the dump that do not exist in the target database
+	CreateTables []string
+
+	// OverwriteTables are tables in the dump that will replace existing tables
+	OverwriteTables []string
+
+	// DropTables are existing tables that will be removed (--drop-db), or swapped
+	// out of the database (--drop-db --atomic)
+	DropTables []string
+
+	// KeepTables are existing tables that are not in the dump and will remain untouched
+	KeepTables []string
+
+	// ShadowDatabase is the temporary database the dump is imported into before
+	// the tables are swapped into the target database (--atomic), if any
+	ShadowDatabase string
+
+	// OldTables are the existing tables renamed with the _old suffix by the swap (--atomic)
+	OldTables []string
+
+	// SwapErr is the reason the swap would be refused, eg: an _old table already exists (--atomic)
+	SwapErr error
+}
+
+// AssetsPlan describes what LoadAssets would do to the assets directory
+type AssetsPlan struct {
+	// Path is the assets directory that will be replaced
+	Path string
+
+	// Exists is whether the assets directory already exists
+	Exists bool
+
+	// ExistingSize is the size of the existing assets directory
+	ExistingSize int64
+
+	// Files is the number of files that would be extracted
+	Files int
+
+	// Skipped is the number of resampled files that would be skipped (--ignore-resampled)
+	Skipped int
+
+	// Excluded is the number of files that would be skipped by the include/exclude filters
+	Excluded int
+
+	// RequiredSize is the uncompressed size of the files that would be extracted
+	RequiredSize int64
+
+	// FreeSpace is the available space at the assets location, -1 if unknown
+	FreeSpace int64
+
+	// Policy is the conflict policy when merging into the existing assets (--merge), if any
+	Policy ConflictPolicy
+
+	// Merge are the files that would be added, skipped or overwritten when merging (--merge)
+	Merge ExtractStats
+}
+
+// PlanDatabase probes the database dump and the target database, and returns
+// what LoadDatabase (or LoadDatabaseAtomic when atomic is set) would do without
+// modifying anything.
+func (f *File) PlanDatabase(dropDatabase, atomic bool) (*DatabasePlan, error) {
+	config := genMySQLConfig()
+	configNoDB := *config
+	configNoDB.DBName = ""
+
+	plan := &DatabasePlan{Host: config.Addr, Name: app.DB.Name}
+
+	adminDB, err := sql.Open("mysql", configNoDB.FormatDSN())
+	if err != nil {
+		return nil, fmt.Errorf("error opening database connection: %s", err.Error())
+	}
+	defer func() { _ = adminDB.Close() }()
+
+	plan.Exists, err = databaseExists(adminDB, app.DB.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if plan.Exists {
+		plan.ExistingTables, err = databaseTables(adminDB, app.DB.Name)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	reader, err := f.openDatabaseReader()
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = reader.Close() }()
+
+	app.Log(fmt.Sprintf("Scanning '%s' for tables", f.DatabaseFile))
+
+	tables, err := dumpTables(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter := newTableFilter(app.Tables, app.IntoTable); filter != nil {
+		matched := []string{}
+		for _, t := range tables {
+			if filter.matches(t) {
+				matched = append(matched, t)
+			}
+		}
+		if filter.into != "" && len(matched) > 1 {
+			return nil, fmt.Errorf("--into-table requires a single table, but %d tables match", len(matched))
+		}
+		if filter.into != "" && len(matched) == 1 {
+			matched[0] = filter.into
+		}
+		tables = matched
+	}
+
+	if atomic {
+		plan.planSwap(tables, dropDatabase)
+	} else {
+		plan.planTables(tables, dropDatabase)
+	}
+
+	return plan, nil
+}
+
+// planTables sets what importing the dump tables directly into the target
+// database would do, after dropping the database when dropDatabase is set
+func (plan *DatabasePlan) planTables(tables []string, dropDatabase bool) {
+	existing := make(map[string]bool, len(plan.ExistingTables))
+	for _, t := range plan.ExistingTables {
+		existing[strings.ToLower(t)] = true
+	}
+
+	inDump := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		inDump[strings.ToLower(t)] = true
+		if existing[strings.ToLower(t)] && !dropDatabase {
+			plan.OverwriteTables = append(plan.OverwriteTables, t)
+		} else {
+			plan.CreateTables = append(plan.CreateTables, t)
+		}
+	}
+
+	if dropDatabase {
+		// every existing table is removed when the database is dropped
+		plan.DropTables = plan.ExistingTables
+	} else {
+		for _, t := range plan.ExistingTables {
+			if !inDump[strings.ToLower(t)] {
+				plan.KeepTables = append(plan.KeepTables, t)
+			}
+		}
+	}
+}
+
+// planSwap sets what importing the dump tables into the shadow database and
+// swapping them into the target database would do (see LoadDatabaseAtomic).
+// The database itself is never dropped: with dropDatabase, the existing tables
+// not in the dump are swapped out along with the replaced tables.
+func (plan *DatabasePlan) planSwap(tables []string, dropDatabase bool) {
+	plan.ShadowDatabase = plan.Name + shadowDatabaseSuffix
+
+	for _, t := range tables {
+		if containsFold(plan.ExistingTables, t) {
+			plan.OverwriteTables = append(plan.OverwriteTables, t)
+		} else {
+			plan.CreateTables = append(plan.CreateTables, t)
+		}
+	}
+
+	for _, t := range plan.ExistingTables {
+		if containsFold(tables, t) {
+			continue
+		}
+		if dropDatabase {
+			plan.DropTables = append(plan.DropTables, t)
+		} else {
+			plan.KeepTables = append(plan.KeepTables, t)
+		}
+	}
+
+	for _, t := range replacedTables(tables, plan.ExistingTables, dropDatabase) {
+		plan.OldTables = append(plan.OldTables, t+oldTableSuffix)
+	}
+
+	_, _, plan.SwapErr = swapStatement(plan.Name, plan.ShadowDatabase, tables, plan.ExistingTables, dropDatabase)
+}
+
+// PlanAssets scans the assets archive and returns what LoadAssets would do
+// to assetsBase without modifying anything.
+func (f *File) PlanAssets(assetsBase string) (*AssetsPlan, error) {
+	return f.planAssets(assetsBase, "")
+}
+
+// PlanMergeAssets scans the assets archive and returns what MergeAssets would
+// do to assetsBase without modifying anything. Each archived file is compared
+// against the existing file (if any) according to policy.
+func (f *File) PlanMergeAssets(assetsBase string, policy ConflictPolicy) (*AssetsPlan, error) {
+	return f.planAssets(assetsBase, policy)
+}
+
+// planAssets scans the assets archive, merging into the existing assets when
+// policy is set
+func (f *File) planAssets(assetsBase string, policy ConflictPolicy) (*AssetsPlan, error) {
+	if assetsBase == "" {
+		assetsBase = "."
+	}
+
+	plan := &AssetsPlan{Path: filepath.Join(assetsBase, "assets"), FreeSpace: -1, Policy: policy}
+
+	if IsDir(plan.Path) {
+		plan.Exists = true
+		plan.ExistingSize, _ = utils.CalcSize(plan.Path)
+	}
+
+	if free, err := utils.FreeSpace(assetsBase); err == nil {
+		plan.FreeSpace = free
+	}
+
+	rawReader, cleanup, err := f.openEntry(f.AssetsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	reader, err := newDecompressReader(rawReader)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = reader.Close() }()
+
+	filter, err := newAssetsFilter(plan.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	app.Log(fmt.Sprintf("Scanning '%s' for files", f.AssetsFile))
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if skipResampled(filepath.Join(assetsBase, filepath.FromSlash(header.Name))) {
+			plan.Skipped++
+			continue
+		}
+
+		if filter.skipFile(assetsRelativePath(header.Name), header.Size) {
+			plan.Excluded++
+			continue
+		}
+
+		plan.Files++
+
+		if policy != "" {
+			existing, err := os.Lstat(filepath.Join(assetsBase, filepath.FromSlash(header.Name)))
+			switch {
+			case err != nil:
+				plan.Merge.Added++
+			case policy.keepExisting(header, existing):
+				plan.Merge.Skipped++
+				continue
+			default:
+				plan.Merge.Overwritten++
+			}
+		}
+
+		plan.RequiredSize += header.Size
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,101 @@
+package sspak
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanAssets(t *testing.T) {
+	app.IgnoreResampled = false
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+	defer func() { app.IgnoreResampled = false }()
+
+	srcBase := t.TempDir()
+	assetsDir := filepath.Join(srcBase, "assets")
+	require.NoError(t, os.MkdirAll(assetsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "photo.jpg"), []byte("12345"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "doc.pdf"), []byte("123"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "photo__FillWzgwLDgwXQ.jpg"), []byte("thumb"), 0644))
+
+	f := &File{TempFolder: t.TempDir()}
+	require.NoError(t, f.AddAssets(assetsDir))
+
+	// existing assets directory in the destination
+	destBase := t.TempDir()
+	existing := filepath.Join(destBase, "assets")
+	require.NoError(t, os.MkdirAll(existing, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(existing, "old.txt"), []byte("old"), 0644))
+
+	// resampled images are only skipped when restoring
+	app.IgnoreResampled = true
+
+	plan, err := f.PlanAssets(destBase)
+	require.NoError(t, err)
+
+	assert.Equal(t, existing, plan.Path)
+	assert.True(t, plan.Exists)
+	assert.Equal(t, int64(3), plan.ExistingSize)
+	assert.Equal(t, 2, plan.Files)
+	assert.Equal(t, 1, plan.Skipped)
+	assert.Equal(t, int64(8), plan.RequiredSize)
+
+	// nothing must have been modified
+	assert.FileExists(t, filepath.Join(existing, "old.txt"))
+	assert.NoDirExists(t, existing+".old")
+}
+
+func TestPlanMergeAssets(t *testing.T) {
+	app.IgnoreResampled = false
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	f := writeTestAssets(t, map[string]string{
+		"older.txt":   "archived",
+		"newer.txt":   "archived",
+		"missing.txt": "archived",
+	})
+
+	now := time.Now()
+	destBase := t.TempDir()
+	existing := filepath.Join(destBase, "assets")
+	require.NoError(t, os.MkdirAll(existing, 0755))
+	for name, mtime := range map[string]time.Time{
+		"older.txt": now.Add(-time.Hour),
+		"newer.txt": now.Add(time.Hour),
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(existing, name), []byte("local"), 0644))
+		require.NoError(t, os.Chtimes(filepath.Join(existing, name), mtime, mtime))
+	}
+
+	tests := []struct {
+		policy ConflictPolicy
+		stats  ExtractStats
+	}{
+		{ConflictSkip, ExtractStats{Added: 1, Skipped: 2}},
+		{ConflictNewer, ExtractStats{Added: 1, Skipped: 1, Overwritten: 1}},
+		{ConflictOverwrite, ExtractStats{Added: 1, Overwritten: 2}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			plan, err := f.PlanMergeAssets(destBase, tt.policy)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.policy, plan.Policy)
+			assert.Equal(t, 3, plan.Files)
+			assert.Equal(t, tt.stats, plan.Merge)
+			assert.Equal(t, int64(len("archived")*(tt.stats.Added+tt.stats.Overwritten)), plan.RequiredSize)
+		})
+	}
+
+	// nothing must have been modified
+	assert.NoFileExists(t, filepath.Join(existing, "missing.txt"))
+	got, err := os.ReadFile(filepath.Join(existing, "older.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "local", string(got))
+}
@@ -0,0 +1,193 @@
+package sspak
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/utils"
+)
+
+// ignoreFile is the name of the file in the assets root containing
+// gitignore-style patterns of files to exclude
+const ignoreFile = ".ssbakignore"
+
+// assetsFilter decides which asset files are archived or restored, according
+// to app.Includes, app.Excludes, app.ExcludeLargerThan, ReferencedOnly and the
+// .ssbakignore file of the assets directory. Names are relative to the assets
+// directory.
+type assetsFilter struct {
+	// includes limits the files to those matching any of the patterns
+	includes []string
+
+	// rules are exclude patterns in order, where the last matching rule wins
+	rules []ignoreRule
+
+	// maxSize is the maximum file size in bytes, or 0 for no limit
+	maxSize int64
+
+	// referenced limits the files to those referenced by the database, if set
+	referenced *ReferencedAssets
+
+	// Excluded is the number of files skipped by the patterns
+	Excluded int
+
+	// TooLarge is the number of files skipped by their size
+	TooLarge int
+
+	// Unreferenced is the number of files skipped as not referenced by the database
+	Unreferenced int
+}
+
+// filtersDisabled disables --ignore-resampled and all asset filters, see unfiltered
+var filtersDisabled bool
+
+// unfiltered disables --ignore-resampled and the asset filters (including
+// .ssbakignore files) until the returned function is called, eg: for rollback
+// snapshots which must be complete
+func unfiltered() func() {
+	ignoreResampled, disabled := app.IgnoreResampled, filtersDisabled
+	app.IgnoreResampled, filtersDisabled = false, true
+
+	return func() { app.IgnoreResampled, filtersDisabled = ignoreResampled, disabled }
+}
+
+// ignoreRule is an exclude pattern, or a pattern re-including files when negated
+type ignoreRule struct {
+	pattern string
+	negate  bool
+}
+
+// newAssetsFilter returns the filter for the assets in assetsDir (which need
+// not exist), or nil if no filters are configured.
+func newAssetsFilter(assetsDir string) (*assetsFilter, error) {
+	if filtersDisabled {
+		return nil, nil
+	}
+
+	filter := &assetsFilter{
+		includes:   app.Includes,
+		maxSize:    app.ExcludeLargerThan,
+		referenced: ReferencedOnly,
+	}
+
+	ignorePath := filepath.Join(assetsDir, ignoreFile)
+	if utils.IsFile(ignorePath) {
+		rules, err := readIgnoreFile(ignorePath)
+		if err != nil {
+			return nil, err
+		}
+		app.Log(fmt.Sprintf("Using %d patterns from '%s'", len(rules), ignorePath))
+		filter.rules = rules
+	}
+
+	for _, pattern := range app.Excludes {
+		filter.rules = append(filter.rules, ignoreRule{pattern: pattern})
+	}
+
+	if len(filter.includes) == 0 && len(filter.rules) == 0 && filter.maxSize == 0 && filter.referenced == nil {
+		return nil, nil
+	}
+
+	return filter, nil
+}
+
+// readIgnoreFile returns the rules of a gitignore-style file, ignoring blank
+// lines and comments. Patterns starting with `!` re-include files.
+func readIgnoreFile(file string) ([]ignoreRule, error) {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	rules := []ignoreRule{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		rule := ignoreRule{pattern: line}
+		if p, ok := strings.CutPrefix(line, "!"); ok {
+			rule = ignoreRule{pattern: p, negate: true}
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, scanner.Err()
+}
+
+// excluded returns whether name matches the exclude rules
+func (a *assetsFilter) excluded(name string) bool {
+	excluded := false
+	for _, rule := range a.rules {
+		if matchPattern(rule.pattern, name) {
+			excluded = !rule.negate
+		}
+	}
+
+	return excluded
+}
+
+// skipDir returns whether the directory name (and everything within it) is
+// excluded. Directories are never skipped when files could be re-included.
+func (a *assetsFilter) skipDir(name string) bool {
+	if a == nil || name == "" {
+		return false
+	}
+
+	for _, rule := range a.rules {
+		if rule.negate {
+			return false
+		}
+	}
+
+	return a.excluded(name)
+}
+
+// skipFile returns whether the file name of size bytes is skipped, counting it if so
+func (a *assetsFilter) skipFile(name string, size int64) bool {
+	if a == nil {
+		return false
+	}
+
+	if (len(a.includes) > 0 && !matchAny(a.includes, name)) || a.excluded(name) {
+		a.Excluded++
+		return true
+	}
+
+	if a.maxSize > 0 && size > a.maxSize {
+		a.TooLarge++
+		return true
+	}
+
+	if a.referenced != nil && !a.referenced.Contains(name) {
+		a.Unreferenced++
+		return true
+	}
+
+	return false
+}
+
+// report prints the number of skipped files, if any
+func (a *assetsFilter) report() {
+	if a == nil || a.Excluded+a.TooLarge+a.Unreferenced == 0 {
+		return
+	}
+
+	msg := fmt.Sprintf("Skipped %d excluded asset files", a.Excluded)
+	if a.maxSize > 0 {
+		msg += fmt.Sprintf(", %d larger than %s", a.TooLarge, utils.ByteToHr(a.maxSize))
+	}
+	if a.referenced != nil {
+		msg += fmt.Sprintf(", %d not referenced by the database", a.Unreferenced)
+	}
+
+	fmt.Println(msg)
+}
@@ -0,0 +1,77 @@
+package sspak
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssetsFilter(t *testing.T) {
+	resetAppState(t)
+
+	filter, err := newAssetsFilter(t.TempDir())
+	require.NoError(t, err)
+	assert.Nil(t, filter, "no filters configured")
+
+	assetsDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, ignoreFile), []byte("# comment\n\n*.tmp\nUploads/private/\n!Uploads/private/keep.pdf\n"), 0644))
+	app.Excludes = []string{"Uploads/videos/**"}
+	app.ExcludeLargerThan = 100
+
+	filter, err = newAssetsFilter(assetsDir)
+	require.NoError(t, err)
+
+	assert.True(t, filter.skipFile("cache.tmp", 1))
+	assert.True(t, filter.skipFile("Uploads/private/secret.pdf", 1))
+	assert.False(t, filter.skipFile("Uploads/private/keep.pdf", 1))
+	assert.True(t, filter.skipFile("Uploads/videos/a/b.mp4", 1))
+	assert.True(t, filter.skipFile("Uploads/large.pdf", 101))
+	assert.False(t, filter.skipFile("Uploads/small.pdf", 100))
+	assert.Equal(t, 3, filter.Excluded)
+	assert.Equal(t, 1, filter.TooLarge)
+
+	// directories are not pruned when files could be re-included
+	assert.False(t, filter.skipDir("Uploads/private"))
+
+	app.Includes = []string{"*.pdf"}
+	filter, err = newAssetsFilter(t.TempDir())
+	require.NoError(t, err)
+	assert.True(t, filter.skipFile("Uploads/image.jpg", 1))
+	assert.False(t, filter.skipFile("Uploads/file.pdf", 1))
+	assert.True(t, filter.skipDir("Uploads/videos"))
+}
+
+func TestAddAndLoadAssetsFiltered(t *testing.T) {
+	resetAppState(t)
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	app.Excludes = []string{"Uploads/videos/**"}
+	app.ExcludeLargerThan = 10
+	f := writeTestAssets(t, map[string]string{
+		"Uploads/file.txt":        "content",
+		"Uploads/large.txt":       "more than ten bytes",
+		"Uploads/videos/clip.mp4": "mp4",
+	})
+
+	entries, err := f.ListAssets(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "Uploads/file.txt", entries[0].Name)
+
+	// filters on load apply to the archived files
+	app.Excludes, app.ExcludeLargerThan = nil, 0
+	f = writeTestAssets(t, map[string]string{
+		"Uploads/file.txt": "content",
+		"Uploads/skip.tmp": "tmp",
+	})
+
+	app.Excludes = []string{"*.tmp"}
+	base := t.TempDir()
+	require.NoError(t, f.LoadAssets(base))
+	assert.FileExists(t, filepath.Join(base, "assets", "Uploads", "file.txt"))
+	assert.NoFileExists(t, filepath.Join(base, "assets", "Uploads", "skip.tmp"))
+}
@@ -0,0 +1,257 @@
+package sspak
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/utils"
+)
+
+// gitRemoteEntry is the name of the git-remote entry of an sspak archive
+const gitRemoteEntry = "git-remote"
+
+var (
+	// gitSectionRegex matches a section of a git config file, eg: [remote "origin"]
+	gitSectionRegex = regexp.MustCompile(`^\[\s*([^\s\]"]+)(?:\s+"([^"]*)")?\s*\]$`)
+
+	// gitSHARegex matches a full commit sha
+	gitSHARegex = regexp.MustCompile(`^[0-9a-f]{40}([0-9a-f]{24})?$`)
+)
+
+// GitRemote is the repository and commit of the site code, stored in the
+// git-remote entry of an sspak archive (compatible with SSPak).
+type GitRemote struct {
+	// Remote is the URL of the remote repository (origin if it exists)
+	Remote string
+
+	// Branch is the checked out branch, or empty for a detached HEAD
+	Branch string
+
+	// SHA is the checked out commit
+	SHA string
+}
+
+// String returns the git-remote entry contents, in the SSPak (ini) format
+func (g GitRemote) String() string {
+	return fmt.Sprintf("remote = %s\nbranch = %s\nsha = %s\n", g.Remote, g.Branch, g.SHA)
+}
+
+// parseGitRemote parses the contents of a git-remote entry
+func parseGitRemote(r io.Reader) (*GitRemote, error) {
+	g := &GitRemote{}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		switch strings.TrimSpace(key) {
+		case "remote":
+			g.Remote = value
+		case "branch":
+			g.Branch = value
+		case "sha":
+			g.SHA = value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if g.SHA == "" {
+		return nil, errors.New("invalid git-remote: no commit sha")
+	}
+
+	return g, nil
+}
+
+// ReadGitRemote returns the remote URL, branch and HEAD commit of the git
+// checkout in dir, read directly from its .git directory.
+func ReadGitRemote(dir string) (*GitRemote, error) {
+	gitDir, commonDir, err := findGitDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return nil, fmt.Errorf("error reading git HEAD: %s", err.Error())
+	}
+
+	g := &GitRemote{}
+
+	ref, isRef := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: ")
+	if isRef {
+		g.Branch = strings.TrimPrefix(ref, "refs/heads/")
+		if g.SHA, err = resolveGitRef(gitDir, commonDir, ref); err != nil {
+			return nil, err
+		}
+	} else {
+		g.SHA = ref
+	}
+
+	if !gitSHARegex.MatchString(g.SHA) {
+		return nil, fmt.Errorf("invalid git HEAD commit '%s'", g.SHA)
+	}
+
+	g.Remote, err = gitRemoteURL(filepath.Join(commonDir, "config"))
+	if err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// findGitDir returns the git directory of the checkout in dir, and the common
+// directory containing its refs and config (which differ for worktrees).
+func findGitDir(dir string) (gitDir, commonDir string, err error) {
+	gitDir = filepath.Join(dir, ".git")
+
+	if utils.IsFile(gitDir) {
+		// worktrees and submodules have a .git file pointing to the git directory
+		data, err := os.ReadFile(filepath.Clean(gitDir))
+		if err != nil {
+			return "", "", err
+		}
+		target, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+		if !ok {
+			return "", "", fmt.Errorf("invalid git file '%s'", gitDir)
+		}
+		gitDir = strings.TrimSpace(target)
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(dir, gitDir)
+		}
+	}
+
+	if !utils.IsDir(gitDir) {
+		return "", "", fmt.Errorf("'%s' is not a git repository", dir)
+	}
+
+	commonDir = gitDir
+	if data, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(data))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+	}
+
+	return gitDir, commonDir, nil
+}
+
+// resolveGitRef returns the commit sha of ref, eg: refs/heads/main, from the
+// loose refs or packed-refs file.
+func resolveGitRef(gitDir, commonDir, ref string) (string, error) {
+	for _, dir := range []string{gitDir, commonDir} {
+		if data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(ref))); err == nil {
+			return strings.TrimSpace(string(data)), nil
+		}
+	}
+
+	file, err := os.Open(filepath.Join(commonDir, "packed-refs"))
+	if err != nil {
+		return "", fmt.Errorf("git ref '%s' not found", ref)
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		sha, name, ok := strings.Cut(scanner.Text(), " ")
+		if ok && name == ref {
+			return sha, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("git ref '%s' not found", ref)
+}
+
+// gitRemoteURL returns the URL of the origin remote in the git config file,
+// or of the first remote if there is no origin.
+func gitRemoteURL(configFile string) (string, error) {
+	file, err := os.Open(filepath.Clean(configFile))
+	if err != nil {
+		return "", fmt.Errorf("error reading git config: %s", err.Error())
+	}
+	defer func() { _ = file.Close() }()
+
+	var remote, first, origin string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if m := gitSectionRegex.FindStringSubmatch(line); m != nil {
+			remote = ""
+			if strings.EqualFold(m[1], "remote") {
+				remote = m[2]
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if remote == "" || !ok || !strings.EqualFold(strings.TrimSpace(key), "url") {
+			continue
+		}
+
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		if remote == "origin" {
+			origin = value
+		} else if first == "" {
+			first = value
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	if origin != "" {
+		return origin, nil
+	}
+
+	return first, nil
+}
+
+// AddGitRemote adds a git-remote entry with the repository and commit of the
+// git checkout in dir.
+func (f *File) AddGitRemote(dir string) error {
+	g, err := ReadGitRemote(dir)
+	if err != nil {
+		return err
+	}
+
+	app.Log(fmt.Sprintf("Adding git remote '%s' (%s)", g.Remote, g.SHA))
+
+	f.GitRemoteFile = filepath.Join(f.TempFolder, gitRemoteEntry)
+
+	return os.WriteFile(f.GitRemoteFile, []byte(g.String()), 0600)
+}
+
+// GitRemote returns the contents of the git-remote entry of f
+func (f *File) GitRemote() (*GitRemote, error) {
+	if f.GitRemoteFile == "" {
+		return nil, errors.New("no git-remote found")
+	}
+
+	r, cleanup, err := f.openEntry(f.GitRemoteFile)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	return parseGitRemote(r)
+}
@@ -0,0 +1,150 @@
+package sspak
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testSHA      = "0123456789abcdef0123456789abcdef01234567"
+	testOtherSHA = "89abcdef0123456789abcdef0123456789abcdef"
+)
+
+// writeTestGitDir creates a minimal .git directory in dir with the given files
+func writeTestGitDir(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		p := filepath.Join(dir, ".git", filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+}
+
+const testGitConfig = `[core]
+	bare = false
+[remote "upstream"]
+	url = https://example.com/upstream.git
+	fetch = +refs/heads/*:refs/remotes/upstream/*
+[remote "origin"]
+	url = git@example.com:site.git
+[branch "main"]
+	remote = origin
+`
+
+func TestReadGitRemote(t *testing.T) {
+	t.Run("loose ref", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestGitDir(t, dir, map[string]string{
+			"HEAD":            "ref: refs/heads/main\n",
+			"refs/heads/main": testSHA + "\n",
+			"config":          testGitConfig,
+		})
+
+		g, err := ReadGitRemote(dir)
+		require.NoError(t, err)
+		assert.Equal(t, &GitRemote{Remote: "git@example.com:site.git", Branch: "main", SHA: testSHA}, g)
+	})
+
+	t.Run("packed ref", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestGitDir(t, dir, map[string]string{
+			"HEAD":        "ref: refs/heads/feature/x\n",
+			"packed-refs": "# pack-refs with: peeled fully-peeled sorted\n" + testOtherSHA + " refs/heads/main\n" + testSHA + " refs/heads/feature/x\n",
+			"config":      "[remote \"upstream\"]\n\turl = https://example.com/upstream.git\n",
+		})
+
+		g, err := ReadGitRemote(dir)
+		require.NoError(t, err)
+		assert.Equal(t, &GitRemote{Remote: "https://example.com/upstream.git", Branch: "feature/x", SHA: testSHA}, g)
+	})
+
+	t.Run("detached head", func(t *testing.T) {
+		dir := t.TempDir()
+		writeTestGitDir(t, dir, map[string]string{
+			"HEAD":   testSHA + "\n",
+			"config": testGitConfig,
+		})
+
+		g, err := ReadGitRemote(dir)
+		require.NoError(t, err)
+		assert.Equal(t, "", g.Branch)
+		assert.Equal(t, testSHA, g.SHA)
+	})
+
+	t.Run("worktree", func(t *testing.T) {
+		main := t.TempDir()
+		writeTestGitDir(t, main, map[string]string{
+			"config":                 testGitConfig,
+			"refs/heads/wt":          testSHA + "\n",
+			"worktrees/wt/HEAD":      "ref: refs/heads/wt\n",
+			"worktrees/wt/commondir": "../..\n",
+		})
+
+		dir := t.TempDir()
+		gitDir := filepath.Join(main, ".git", "worktrees", "wt")
+		require.NoError(t, os.WriteFile(filepath.Join(dir, ".git"), []byte("gitdir: "+gitDir+"\n"), 0644))
+
+		g, err := ReadGitRemote(dir)
+		require.NoError(t, err)
+		assert.Equal(t, &GitRemote{Remote: "git@example.com:site.git", Branch: "wt", SHA: testSHA}, g)
+	})
+
+	t.Run("not a repository", func(t *testing.T) {
+		_, err := ReadGitRemote(t.TempDir())
+		assert.Error(t, err)
+	})
+}
+
+func TestParseGitRemote(t *testing.T) {
+	g := GitRemote{Remote: "git@example.com:site.git", Branch: "main", SHA: testSHA}
+
+	parsed, err := parseGitRemote(strings.NewReader(g.String()))
+	require.NoError(t, err)
+	assert.Equal(t, &g, parsed)
+
+	_, err = parseGitRemote(strings.NewReader("remote = x\n"))
+	assert.Error(t, err)
+}
+
+func TestAddGitRemote(t *testing.T) {
+	resetAppState(t)
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	dir := t.TempDir()
+	writeTestGitDir(t, dir, map[string]string{
+		"HEAD":            "ref: refs/heads/main\n",
+		"refs/heads/main": testSHA + "\n",
+		"config":          testGitConfig,
+	})
+
+	f := &File{TempFolder: t.TempDir()}
+	f.DatabaseFile = writeCompressedSQL(t, f.TempFolder, testDump, false)
+	require.NoError(t, f.AddGitRemote(dir))
+
+	sspakPath := filepath.Join(t.TempDir(), "test.sspak")
+	require.NoError(t, f.Write(sspakPath))
+
+	probed, err := Probe(sspakPath)
+	require.NoError(t, err)
+	assert.Equal(t, gitRemoteEntry, probed.GitRemoteFile)
+
+	g, err := probed.GitRemote()
+	require.NoError(t, err)
+	assert.Equal(t, testSHA, g.SHA)
+
+	// the git-remote is kept when converting an archive
+	convertedPath := filepath.Join(t.TempDir(), "converted.sspak")
+	require.NoError(t, Convert(sspakPath, convertedPath, CompressionOptions{Algorithm: CompressionZSTD}))
+	converted, err := Probe(convertedPath)
+	require.NoError(t, err)
+	assert.Equal(t, gitRemoteEntry, converted.GitRemoteFile)
+	assert.Equal(t, readSSPakEntry(t, sspakPath, gitRemoteEntry), readSSPakEntry(t, convertedPath, gitRemoteEntry))
+}
@@ -0,0 +1,81 @@
+package sspak
+
+import (
+	"path"
+	"strings"
+)
+
+// matchPattern returns whether the slash-separated name (relative to the assets
+// directory) matches the gitignore-style pattern. Patterns support the usual
+// glob syntax (`*`, `?`, `[a-z]`) within a path segment, and `**` to match any
+// number of directories. Patterns without a slash match at any depth, and a
+// pattern matching a directory also matches everything within it.
+func matchPattern(pattern, name string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+	if pattern == "" {
+		return false
+	}
+
+	patternSegments := strings.Split(pattern, "/")
+	if !anchored {
+		patternSegments = append([]string{"**"}, patternSegments...)
+	}
+
+	return matchSegments(patternSegments, strings.Split(strings.Trim(name, "/"), "/"))
+}
+
+// matchSegments matches pattern segments against name segments. Any remaining
+// name segments once the pattern is exhausted are within a matched directory.
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			pattern = pattern[1:]
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i < len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+
+		pattern, name = pattern[1:], name[1:]
+	}
+
+	return true
+}
+
+// assetsRelativePath returns the path of an assets archive entry relative to
+// the top-level (assets) directory, eg: "/assets/Uploads/file.pdf" returns
+// "Uploads/file.pdf". The top-level directory itself returns an empty string.
+func assetsRelativePath(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if i := strings.Index(name, "/"); i >= 0 {
+		return name[i+1:]
+	}
+
+	return ""
+}
+
+// matchAny returns whether name matches any of the patterns
+func matchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if matchPattern(p, name) {
+			return true
+		}
+	}
+
+	return false
+}
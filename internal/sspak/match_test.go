@@ -0,0 +1,48 @@
+package sspak
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"Uploads/reports/*.pdf", "Uploads/reports/q1.pdf", true},
+		{"Uploads/reports/*.pdf", "Uploads/reports/2020/q1.pdf", false},
+		{"Uploads/reports/*.pdf", "Uploads/q1.pdf", false},
+		{"/Uploads/reports/*.pdf", "Uploads/reports/q1.pdf", true},
+		// patterns without a slash match at any depth
+		{"*.pdf", "q1.pdf", true},
+		{"*.pdf", "Uploads/reports/q1.pdf", true},
+		{"*.pdf", "Uploads/reports/q1.jpg", false},
+		// ** matches any number of directories
+		{"Uploads/**/*.pdf", "Uploads/q1.pdf", true},
+		{"Uploads/**/*.pdf", "Uploads/a/b/c/q1.pdf", true},
+		{"Uploads/videos/**", "Uploads/videos/a/clip.mp4", true},
+		{"Uploads/videos/**", "Uploads/photo.jpg", false},
+		// directories match everything within them
+		{"Uploads/reports", "Uploads/reports/2020/q1.pdf", true},
+		{"Uploads/reports/", "Uploads/reports/q1.pdf", true},
+		{"reports", "Uploads/reports/q1.pdf", true},
+		{"Uploads/report", "Uploads/reports/q1.pdf", false},
+		{"q?.pdf", "q1.pdf", true},
+		{"q[0-9].pdf", "qa.pdf", false},
+		{"", "q1.pdf", false},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.expected, matchPattern(tt.pattern, tt.name), "pattern %q, name %q", tt.pattern, tt.name)
+	}
+}
+
+func TestAssetsRelativePath(t *testing.T) {
+	assert.Equal(t, "Uploads/file.pdf", assetsRelativePath("/assets/Uploads/file.pdf"))
+	assert.Equal(t, "file.pdf", assetsRelativePath("assets/file.pdf"))
+	assert.Equal(t, "", assetsRelativePath("/assets"))
+	assert.Equal(t, "", assetsRelativePath("/assets/"))
+}
@@ -0,0 +1,56 @@
+package sspak
+
+import (
+	"errors"
+)
+
+// Merge returns a File combining the database of db and the assets (including
+// protected assets and additional directories) of assets (either may be nil),
+// and the code & git-remote of db (or else assets). When written, the entries
+// are copied as-is from their source sspak files (see Probe), without
+// decompression or temporary files.
+func Merge(db, assets *File) (*File, error) {
+	f := &File{sources: map[string]string{}}
+
+	if db != nil {
+		if db.DatabaseFile == "" {
+			return nil, errors.New("the database source does not contain a database")
+		}
+		f.DatabaseFile = db.DatabaseFile
+		if src := db.entrySource(db.DatabaseFile); src != "" {
+			f.sources[f.DatabaseFile] = src
+		}
+	}
+
+	if assets != nil {
+		if assets.AssetsFile == "" {
+			return nil, errors.New("the assets source does not contain any assets")
+		}
+		f.AssetsFile = assets.AssetsFile
+		f.ProtectedAssetsFile, f.DirectoriesFile = assets.ProtectedAssetsFile, assets.DirectoriesFile
+		for _, entry := range []string{f.AssetsFile, f.ProtectedAssetsFile, f.DirectoriesFile} {
+			if src := assets.entrySource(entry); entry != "" && src != "" {
+				f.sources[entry] = src
+			}
+		}
+	}
+
+	if f.DatabaseFile == "" && f.AssetsFile == "" {
+		return nil, errors.New("nothing to merge")
+	}
+
+	// the code & git-remote describe the site code, which belongs with the database
+	for _, src := range []*File{db, assets} {
+		if src == nil || f.GitRemoteFile != "" || f.CodeFile != "" {
+			continue
+		}
+		f.GitRemoteFile, f.CodeFile = src.GitRemoteFile, src.CodeFile
+		for _, entry := range []string{f.GitRemoteFile, f.CodeFile} {
+			if s := src.entrySource(entry); entry != "" && s != "" {
+				f.sources[entry] = s
+			}
+		}
+	}
+
+	return f, nil
+}
@@ -0,0 +1,84 @@
+package sspak
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge(t *testing.T) {
+	resetAppState(t)
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	// a: zstd database, b: gzip database & assets
+	tmpDir := t.TempDir()
+	a := &File{DatabaseFile: writeCompressedSQL(t, tmpDir, testDump, true), TempFolder: tmpDir}
+	aPath := filepath.Join(t.TempDir(), "a.sspak")
+	require.NoError(t, a.Write(aPath))
+
+	b := writeTestAssets(t, map[string]string{"Uploads/file.txt": "content"})
+	b.DatabaseFile = writeCompressedSQL(t, b.TempFolder, "-- other", false)
+	bPath := filepath.Join(t.TempDir(), "b.sspak")
+	require.NoError(t, b.Write(bPath))
+
+	dbSource, err := Probe(aPath)
+	require.NoError(t, err)
+	assetsSource, err := Probe(bPath)
+	require.NoError(t, err)
+
+	merged, err := Merge(dbSource, assetsSource)
+	require.NoError(t, err)
+
+	outPath := filepath.Join(t.TempDir(), "out.sspak")
+	require.NoError(t, merged.Write(outPath))
+
+	out, err := Probe(outPath)
+	require.NoError(t, err)
+	assert.Equal(t, "database.sql.zst", out.DatabaseFile)
+	assert.Equal(t, "assets.tar.gz", out.AssetsFile)
+
+	// the entries are copied byte for byte
+	for _, entry := range []struct{ src, name string }{{aPath, out.DatabaseFile}, {bPath, out.AssetsFile}} {
+		assert.Equal(t, readSSPakEntry(t, entry.src, entry.name), readSSPakEntry(t, outPath, entry.name))
+	}
+
+	entries, err := out.ListAssets(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "Uploads/file.txt", entries[0].Name)
+}
+
+func TestMergeMissingEntry(t *testing.T) {
+	_, err := Merge(&File{AssetsFile: "assets.tar.gz"}, nil)
+	assert.Error(t, err)
+
+	_, err = Merge(nil, nil)
+	assert.Error(t, err)
+}
+
+// readSSPakEntry returns the raw contents of the named entry of an sspak file
+func readSSPakEntry(t *testing.T, sspakFile, name string) []byte {
+	t.Helper()
+
+	f, err := os.Open(sspakFile)
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	tr := tar.NewReader(f)
+	for {
+		header, err := tr.Next()
+		require.NoError(t, err)
+		if header.Name == name {
+			data, err := io.ReadAll(tr)
+			require.NoError(t, err)
+			return data
+		}
+	}
+}
@@ -1,30 +1,25 @@
 package sspak
 
 import (
-	"bufio"
-	"compress/gzip"
 	"database/sql"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/aliakseiz/go-mysqldump"
 	"github.com/axllent/ssbak/app"
 	"github.com/axllent/ssbak/internal/utils"
 	"github.com/go-sql-driver/mysql"
-	"github.com/klauspost/compress/zstd"
 )
 
-// AddDatabase will dump a database and compress it using either gzip or zstd
+// AddDatabase will dump a database and compress it according to Compression
 func (f *File) AddDatabase() error {
 	config := genMySQLConfig()
 
-	f.DatabaseFile = filepath.Join(f.TempFolder, "database.sql.gz")
-	if UseZSTD {
-		f.DatabaseFile = filepath.Join(f.TempFolder, "database.sql.zst")
-	}
+	f.DatabaseFile = filepath.Join(f.TempFolder, "database.sql"+Compression.extension())
 
 	file, err := os.Create(f.DatabaseFile)
 	if err != nil {
@@ -45,14 +40,9 @@ func (f *File) AddDatabase() error {
 
 	defer func() { _ = db.Close() }()
 
-	var compressor io.WriteCloser
-	if UseZSTD {
-		compressor, err = zstd.NewWriter(file)
-		if err != nil {
-			return fmt.Errorf("error creating zstd writer: %s", err.Error())
-		}
-	} else {
-		compressor = gzip.NewWriter(file)
+	compressor, err := Compression.newWriter(file)
+	if err != nil {
+		return err
 	}
 
 	app.Log(fmt.Sprintf("Dumping database to '%s'", f.DatabaseFile))
@@ -87,12 +77,9 @@ func (f *File) AddDatabase() error {
 }
 
 // AddDatabaseFromFile compresses an existing SQL file into the temp folder using
-// either gzip or zstd (controlled by UseZSTD), and sets f.DatabaseFile.
+// Compression, and sets f.DatabaseFile.
 func (f *File) AddDatabaseFromFile(sqlFile string) error {
-	f.DatabaseFile = filepath.Join(f.TempFolder, "database.sql.gz")
-	if UseZSTD {
-		f.DatabaseFile = filepath.Join(f.TempFolder, "database.sql.zst")
-	}
+	f.DatabaseFile = filepath.Join(f.TempFolder, "database.sql"+Compression.extension())
 
 	src, err := os.Open(filepath.Clean(sqlFile))
 	if err != nil {
@@ -112,15 +99,10 @@ func (f *File) AddDatabaseFromFile(sqlFile string) error {
 	inSize, _ := utils.CalcSize(sqlFile)
 	app.Log(fmt.Sprintf("Compressing '%s' (%s) to '%s'", sqlFile, utils.ByteToHr(inSize), f.DatabaseFile))
 
-	var compressor io.WriteCloser
-	if UseZSTD {
-		compressor, err = zstd.NewWriter(outFile)
-		if err != nil {
-			_ = outFile.Close()
-			return fmt.Errorf("error creating zstd writer: %s", err.Error())
-		}
-	} else {
-		compressor = gzip.NewWriter(outFile)
+	compressor, err := Compression.newWriter(outFile)
+	if err != nil {
+		_ = outFile.Close()
+		return err
 	}
 
 	if _, err := io.Copy(compressor, src); err != nil {
@@ -141,7 +123,7 @@ func (f *File) AddDatabaseFromFile(sqlFile string) error {
 }
 
 // LoadDatabase creates the target database (optionally dropping it first) and
-// imports the SQL dump from f.DatabaseFile, supporting both gzip and zstd.
+// imports the SQL dump from f.DatabaseFile, detecting the compression from its contents.
 func (f *File) LoadDatabase(dropDatabase bool) error {
 	config := genMySQLConfig()
 	configNoDB := *config
@@ -167,90 +149,146 @@ func (f *File) LoadDatabase(dropDatabase bool) error {
 		return err
 	}
 
-	// Import the dump — either stream directly from the sspak or open the temp file.
-	var rawReader io.Reader
-	if f.SourceSSPak != "" {
-		entryReader, cleanup, err := openSSPakEntry(f.SourceSSPak, f.DatabaseFile)
-		if err != nil {
-			return err
-		}
-		defer cleanup()
-		rawReader = entryReader
-	} else {
-		file, err := os.Open(filepath.Clean(f.DatabaseFile))
-		if err != nil {
-			return err
-		}
-		defer func() {
-			if err := file.Close(); err != nil {
-				fmt.Printf("error closing file: %s\n", err)
-			}
-		}()
-		rawReader = file
+	if _, err := f.importDatabase(config); err != nil {
+		return err
 	}
 
-	var reader io.ReadCloser
-	if strings.HasSuffix(f.DatabaseFile, ".zst") {
-		zstdDecoder, err := zstd.NewReader(rawReader)
-		if err != nil {
-			return fmt.Errorf("error creating zstd reader: %s", err.Error())
-		}
-		reader = zstdDecoder.IOReadCloser()
-	} else {
-		reader, err = gzip.NewReader(rawReader)
-		if err != nil {
-			return fmt.Errorf("error creating gzip reader: %s", err.Error())
-		}
+	app.Log(fmt.Sprintf("Imported '%s' to '%s'", f.DatabaseFile, app.DB.Name))
+
+	return nil
+}
+
+// importDatabase imports the SQL dump from f.DatabaseFile into the database of
+// config, and returns the names of the tables created by the dump.
+func (f *File) importDatabase(config *mysql.Config) ([]string, error) {
+	reader, err := f.openDatabaseReader()
+	if err != nil {
+		return nil, err
 	}
 	defer func() { _ = reader.Close() }()
 
 	db, err := sql.Open("mysql", config.FormatDSN())
 	if err != nil {
-		return fmt.Errorf("error opening database: %s", err.Error())
+		return nil, fmt.Errorf("error opening database: %s", err.Error())
 	}
 	defer func() { _ = db.Close() }()
 
-	scanner := bufio.NewScanner(reader)
-	scanner.Split(bufio.ScanLines)
-	buf := make([]byte, 0, bufio.MaxScanTokenSize)
-	// ~32MB buffer to handle very long lines
-	scanner.Buffer(buf, bufio.MaxScanTokenSize*500)
-
-	app.Log(fmt.Sprintf("Importing database to '%s'", app.DB.Name))
+	app.Log(fmt.Sprintf("Importing database to '%s'", config.DBName))
 
 	// Ensure compatibility with MySQL & MariaDB across strict mode variants
 	if _, err := db.Exec("SET sql_mode = '';"); err != nil {
-		return err
+		return nil, err
 	}
 
-	stmt := ""
-	for scanner.Scan() {
-		line := scanner.Text()
-		switch {
-		case strings.HasPrefix(line, "/*!") || strings.HasPrefix(line, "--") || line == "":
-			// skip comments and blank lines
-		case strings.HasSuffix(line, ";"):
-			stmt += line + " "
-			if strings.TrimSpace(stmt) != "" {
-				if _, err := db.Exec(stmt); err != nil {
-					return err
-				}
+	filter := newTableFilter(app.Tables, app.IntoTable)
+	if filter != nil {
+		app.Log(fmt.Sprintf("Only importing tables matching '%s'", strings.Join(app.Tables, "', '")))
+	}
+
+	rewriter, err := newURLRewriter(app.RewriteURLs)
+	if err != nil {
+		return nil, err
+	}
+	if rewriter != nil {
+		app.Log(fmt.Sprintf("Rewriting URLs '%s'", strings.Join(app.RewriteURLs, "', '")))
+	}
+
+	tables := []string{}
+	err = scanStatements(reader, func(stmt string) error {
+		if filter != nil {
+			var err error
+			if stmt, err = filter.apply(stmt); err != nil || stmt == "" {
+				return err
 			}
-			stmt = ""
-		default:
-			stmt += "\n" + line
 		}
+		if rewriter != nil {
+			stmt = rewriter.apply(stmt)
+		}
+		if m := createTableRegex.FindStringSubmatch(stmt); m != nil {
+			tables = append(tables, m[1])
+		}
+		_, err := db.Exec(stmt)
+		return err
+	})
+	if err != nil {
+		return tables, err
 	}
 
-	if strings.TrimSpace(stmt) != "" {
-		if _, err := db.Exec(stmt); err != nil {
-			return err
+	if filter != nil && len(tables) == 0 {
+		return tables, fmt.Errorf("no tables matching '%s' found in '%s'", strings.Join(app.Tables, "', '"), f.DatabaseFile)
+	}
+
+	rewriter.report()
+
+	return tables, nil
+}
+
+// openDatabaseReader returns a decompressed reader for f.DatabaseFile, streamed
+// directly from the sspak when f.SourceSSPak is set. Closing the returned reader
+// also closes the underlying file.
+func (f *File) openDatabaseReader() (io.ReadCloser, error) {
+	rawReader, cleanup, err := f.openEntry(f.DatabaseFile)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := newDecompressReader(rawReader)
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+
+	return &entryReadCloser{ReadCloser: reader, cleanup: cleanup}, nil
+}
+
+// databaseExists returns whether the named database exists
+func databaseExists(db *sql.DB, name string) (bool, error) {
+	var schema string
+	err := db.QueryRow("SELECT SCHEMA_NAME FROM information_schema.SCHEMATA WHERE SCHEMA_NAME = ?", name).Scan(&schema)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// dropDatabase drops the named database if it exists
+func dropDatabase(name string) error {
+	config := genMySQLConfig()
+	config.DBName = ""
+
+	adminDB, err := sql.Open("mysql", config.FormatDSN())
+	if err != nil {
+		return fmt.Errorf("error opening database connection: %s", err.Error())
+	}
+	defer func() { _ = adminDB.Close() }()
+
+	app.Log(fmt.Sprintf("Dropping database '%s'", name))
+	_, err = adminDB.Exec("DROP DATABASE IF EXISTS `" + name + "`")
+
+	return err
+}
+
+// databaseTables returns the sorted table names of the given database
+func databaseTables(db *sql.DB, name string) ([]string, error) {
+	rows, err := db.Query("SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ?", name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	tables := []string{}
+	for rows.Next() {
+		var t string
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
 		}
+		tables = append(tables, t)
 	}
 
-	app.Log(fmt.Sprintf("Imported '%s' to '%s'", f.DatabaseFile, app.DB.Name))
+	sort.Strings(tables)
 
-	return nil
+	return tables, rows.Err()
 }
 
 func genMySQLConfig() *mysql.Config {
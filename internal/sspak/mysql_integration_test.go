@@ -31,13 +31,17 @@ func configureDBFromEnv(t *testing.T) {
 	app.DB.Password = os.Getenv("TEST_DB_PASS")
 	app.DB.Name = os.Getenv("TEST_DB_NAME")
 
-	UseZSTD = false
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
 	app.OnlyDB = false
 	app.OnlyAssets = false
+	app.Tables = nil
+	app.IntoTable = ""
 	t.Cleanup(func() {
-		UseZSTD = false
+		Compression = CompressionOptions{Algorithm: CompressionGzip}
 		app.OnlyDB = false
 		app.OnlyAssets = false
+		app.Tables = nil
+		app.IntoTable = ""
 		app.TempDir = ""
 	})
 }
@@ -106,7 +110,7 @@ func TestAddDatabaseGzipIntegration(t *testing.T) {
 
 func TestAddDatabaseZSTDIntegration(t *testing.T) {
 	configureDBFromEnv(t)
-	UseZSTD = true
+	Compression = CompressionOptions{Algorithm: CompressionZSTD}
 	seedDB(t)
 
 	f := &File{TempFolder: t.TempDir()}
@@ -148,7 +152,7 @@ func TestLoadDatabaseDropIntegration(t *testing.T) {
 
 func TestLoadDatabaseZSTDIntegration(t *testing.T) {
 	configureDBFromEnv(t)
-	UseZSTD = true
+	Compression = CompressionOptions{Algorithm: CompressionZSTD}
 	seedDB(t)
 
 	f := &File{TempFolder: t.TempDir()}
@@ -209,3 +213,227 @@ func TestDatabaseRoundtripThroughSSPakIntegration(t *testing.T) {
 	require.NoError(t, rows.Err())
 	assert.Equal(t, []string{"hello", "world"}, messages)
 }
+
+func TestPlanDatabaseIntegration(t *testing.T) {
+	configureDBFromEnv(t)
+	seedDB(t)
+
+	f := &File{TempFolder: t.TempDir()}
+	require.NoError(t, f.AddDatabase())
+
+	db, err := sql.Open("mysql", dbDSN())
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE extra (id INT PRIMARY KEY)`)
+	require.NoError(t, err)
+
+	plan, err := f.PlanDatabase(false, false)
+	require.NoError(t, err)
+	assert.True(t, plan.Exists)
+	assert.Equal(t, []string{"greetings"}, plan.OverwriteTables)
+	assert.Equal(t, []string{"extra"}, plan.KeepTables)
+	assert.Empty(t, plan.CreateTables)
+
+	plan, err = f.PlanDatabase(true, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"greetings"}, plan.CreateTables)
+	assert.Equal(t, []string{"extra", "greetings"}, plan.DropTables)
+
+	plan, err = f.PlanDatabase(false, true)
+	require.NoError(t, err)
+	assert.Equal(t, app.DB.Name+"_ssbak_tmp", plan.ShadowDatabase)
+	assert.Equal(t, []string{"greetings"}, plan.OverwriteTables)
+	assert.Equal(t, []string{"greetings_old"}, plan.OldTables)
+	assert.NoError(t, plan.SwapErr)
+
+	// the dry run must not have modified anything
+	assert.Equal(t, 2, rowCount(t, "greetings"))
+	assert.Equal(t, 0, rowCount(t, "extra"))
+}
+
+func TestRollbackDatabaseIntegration(t *testing.T) {
+	configureDBFromEnv(t)
+	t.Setenv("TMPDIR", t.TempDir())
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	seedDB(t)
+
+	rollback, err := CreateRollback(&File{}, t.TempDir(), true, false)
+	require.NoError(t, err)
+	assert.FileExists(t, rollback.Path)
+
+	// simulate a half-loaded database
+	db, err := sql.Open("mysql", dbDSN())
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`DELETE FROM greetings`)
+	require.NoError(t, err)
+	assert.Equal(t, 0, rowCount(t, "greetings"))
+
+	require.NoError(t, rollback.Restore("", true, false))
+	assert.Equal(t, 2, rowCount(t, "greetings"))
+	assert.NoFileExists(t, rollback.Path)
+}
+
+func TestLoadDatabaseAtomicIntegration(t *testing.T) {
+	configureDBFromEnv(t)
+	seedDB(t)
+
+	f := &File{TempFolder: t.TempDir()}
+	require.NoError(t, f.AddDatabase())
+
+	db, err := sql.Open("mysql", dbDSN())
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`INSERT INTO greetings (message) VALUES ('changed')`)
+	require.NoError(t, err)
+	_, err = db.Exec(`CREATE TABLE extra (id INT PRIMARY KEY)`)
+	require.NoError(t, err)
+
+	require.NoError(t, f.LoadDatabaseAtomic(false, true))
+	assert.Equal(t, 2, rowCount(t, "greetings"))
+	assert.Equal(t, 3, rowCount(t, "greetings_old"))
+	assert.Equal(t, 0, rowCount(t, "extra"), "tables not in the dump are left untouched")
+
+	// a kept _old table is never dropped by a later swap
+	err = f.LoadDatabaseAtomic(false, false)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "greetings_old' already exists")
+	assert.Equal(t, 3, rowCount(t, "greetings_old"))
+
+	_, err = db.Exec("DROP TABLE greetings_old")
+	require.NoError(t, err)
+
+	// without --keep-old-tables the replaced table is dropped after the swap
+	require.NoError(t, f.LoadDatabaseAtomic(false, false))
+	assert.Equal(t, 2, rowCount(t, "greetings"))
+
+	admin, err := sql.Open("mysql", adminDSN())
+	require.NoError(t, err)
+	defer admin.Close()
+
+	tables, err := databaseTables(admin, app.DB.Name)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"extra", "greetings"}, tables)
+
+	exists, err := databaseExists(admin, app.DB.Name+shadowDatabaseSuffix)
+	require.NoError(t, err)
+	assert.False(t, exists, "shadow database should be dropped")
+}
+
+func TestLoadDatabaseTablesIntegration(t *testing.T) {
+	configureDBFromEnv(t)
+	seedDB(t)
+
+	db, err := sql.Open("mysql", dbDSN())
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`CREATE TABLE other (id INT PRIMARY KEY)`)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO other VALUES (1)`)
+	require.NoError(t, err)
+
+	f := &File{TempFolder: t.TempDir()}
+	require.NoError(t, f.AddDatabase())
+
+	_, err = db.Exec(`DELETE FROM greetings`)
+	require.NoError(t, err)
+	_, err = db.Exec(`DELETE FROM other`)
+	require.NoError(t, err)
+
+	// restore a single table alongside the live data
+	app.Tables = []string{"greet*"}
+	app.IntoTable = "greetings_restored"
+	require.NoError(t, f.LoadDatabase(false))
+	assert.Equal(t, 2, rowCount(t, "greetings_restored"))
+	assert.Equal(t, 0, rowCount(t, "greetings"))
+
+	// restore a single table in place
+	app.IntoTable = ""
+	require.NoError(t, f.LoadDatabase(false))
+	assert.Equal(t, 2, rowCount(t, "greetings"))
+	assert.Equal(t, 0, rowCount(t, "other"), "other tables are not restored")
+
+	app.Tables = []string{"nonexistent"}
+	assert.Error(t, f.LoadDatabase(false))
+}
+
+func TestLiveSnapshotDatabaseIntegration(t *testing.T) {
+	configureDBFromEnv(t)
+	seedDB(t)
+
+	f := &File{TempFolder: t.TempDir()}
+	require.NoError(t, f.AddDatabase())
+
+	archive, err := f.Snapshot(false)
+	require.NoError(t, err)
+
+	live, err := LiveSnapshot("live", "", false, true, false)
+	require.NoError(t, err)
+
+	// the dump and the live database are identical, including the schema
+	assert.Equal(t, int64(2), live.Tables["greetings"].Rows)
+	assert.True(t, Compare(archive, live).Empty(), "%+v", Compare(archive, live))
+
+	db, err := sql.Open("mysql", dbDSN())
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`INSERT INTO greetings (message) VALUES ('drift')`)
+	require.NoError(t, err)
+
+	live, err = LiveSnapshot("live", "", false, true, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"greetings"}, Compare(archive, live).TablesChanged)
+}
+
+func TestLoadReferencedAssetsIntegration(t *testing.T) {
+	configureDBFromEnv(t)
+	seedDB(t)
+
+	_, err := LoadReferencedAssets()
+	assert.Error(t, err, "expected an error without File tables")
+
+	db, err := sql.Open("mysql", dbDSN())
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("CREATE TABLE `File` (ID INT PRIMARY KEY, FileFilename VARCHAR(255), FileHash VARCHAR(255))")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO `File` VALUES (1, 'Uploads/image.jpg', '1a2b3c4d5e6f'), (2, NULL, NULL)")
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE `File_Versions` (ID INT PRIMARY KEY, FileFilename VARCHAR(255), FileHash VARCHAR(255))")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO `File_Versions` VALUES (1, 'Uploads/old.jpg', 'abcdef1234ff')")
+	require.NoError(t, err)
+
+	r, err := LoadReferencedAssets()
+	require.NoError(t, err)
+	assert.True(t, r.Contains("Uploads/image.jpg"))
+	assert.True(t, r.Contains(".protected/Uploads/abcdef1234/old.jpg"))
+	assert.False(t, r.Contains("Uploads/orphan.jpg"))
+}
+
+func TestLoadDatabaseRewriteURLsIntegration(t *testing.T) {
+	configureDBFromEnv(t)
+	seedDB(t)
+
+	db, err := sql.Open("mysql", dbDSN())
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO greetings (message) VALUES ('https://www.example.com/about'), ('a:1:{i:0;s:24:"https://www.example.com/";}')`)
+	require.NoError(t, err)
+
+	f := &File{TempFolder: t.TempDir()}
+	require.NoError(t, f.AddDatabase())
+
+	app.RewriteURLs = []string{"https://www.example.com=https://staging.example.com"}
+	t.Cleanup(func() { app.RewriteURLs = nil })
+
+	require.NoError(t, f.LoadDatabase(true))
+
+	var n int
+	require.NoError(t, db.QueryRow("SELECT COUNT(*) FROM greetings WHERE message = 'https://staging.example.com/about'").Scan(&n))
+	assert.Equal(t, 1, n)
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM greetings WHERE message = 'a:1:{i:0;s:28:"https://staging.example.com/";}'`).Scan(&n))
+	assert.Equal(t, 1, n)
+}
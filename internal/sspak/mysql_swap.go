@@ -0,0 +1,172 @@
+package sspak
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+)
+
+const (
+	// shadowDatabaseSuffix is appended to the database name for the temporary import database
+	shadowDatabaseSuffix = "_ssbak_tmp"
+
+	// oldTableSuffix is appended to the names of tables replaced by an atomic swap
+	oldTableSuffix = "_old"
+)
+
+// LoadDatabaseAtomic imports the SQL dump into a temporary shadow database
+// (<name>_ssbak_tmp), validates it, and then swaps the imported tables into the
+// live database with a single atomic RENAME TABLE statement. Replaced tables
+// are renamed with an _old suffix, and are dropped unless keepOld is set.
+// When dropDatabase is set, live tables not in the dump are swapped out too.
+func (f *File) LoadDatabaseAtomic(dropDatabase, keepOld bool) error {
+	config := genMySQLConfig()
+	configNoDB := *config
+	configNoDB.DBName = ""
+
+	shadowConfig := *config
+	shadowConfig.DBName = app.DB.Name + shadowDatabaseSuffix
+
+	adminDB, err := sql.Open("mysql", configNoDB.FormatDSN())
+	if err != nil {
+		return fmt.Errorf("error opening database connection: %s", err.Error())
+	}
+	defer func() { _ = adminDB.Close() }()
+
+	app.Log(fmt.Sprintf("Creating shadow database '%s'", shadowConfig.DBName))
+
+	if _, err := adminDB.Exec("DROP DATABASE IF EXISTS `" + shadowConfig.DBName + "`"); err != nil {
+		return err
+	}
+	if _, err := adminDB.Exec("CREATE DATABASE `" + shadowConfig.DBName + "`"); err != nil {
+		return err
+	}
+
+	defer func() {
+		app.Log(fmt.Sprintf("Dropping shadow database '%s'", shadowConfig.DBName))
+		if _, err := adminDB.Exec("DROP DATABASE IF EXISTS `" + shadowConfig.DBName + "`"); err != nil {
+			fmt.Printf("Error dropping shadow database: %s\n", err)
+		}
+	}()
+
+	tables, err := f.importDatabase(&shadowConfig)
+	if err != nil {
+		return err
+	}
+
+	app.Log(fmt.Sprintf("Validating shadow database '%s'", shadowConfig.DBName))
+
+	if err := validateShadowDatabase(adminDB, shadowConfig.DBName, tables); err != nil {
+		return err
+	}
+
+	app.Log(fmt.Sprintf("Creating database (if not exists) '%s'", app.DB.Name))
+
+	if _, err := adminDB.Exec("CREATE DATABASE IF NOT EXISTS `" + app.DB.Name + "`"); err != nil {
+		return err
+	}
+
+	liveTables, err := databaseTables(adminDB, app.DB.Name)
+	if err != nil {
+		return err
+	}
+
+	// existing _old tables (eg: kept by a previous --keep-old-tables) are never
+	// dropped, swapStatement refuses to overwrite them instead
+	swap, replaced, err := swapStatement(app.DB.Name, shadowConfig.DBName, tables, liveTables, dropDatabase)
+	if err != nil {
+		return err
+	}
+
+	app.Log(fmt.Sprintf("Swapping %d tables into '%s'", len(tables), app.DB.Name))
+
+	if _, err := adminDB.Exec(swap); err != nil {
+		return fmt.Errorf("error swapping tables: %s", err.Error())
+	}
+
+	if keepOld {
+		if len(replaced) > 0 {
+			app.Log(fmt.Sprintf("Kept %d replaced tables with the '%s' suffix", len(replaced), oldTableSuffix))
+		}
+	} else {
+		for _, t := range replaced {
+			app.Log(fmt.Sprintf("Dropping replaced table '%s%s'", t, oldTableSuffix))
+			if _, err := adminDB.Exec(fmt.Sprintf("DROP TABLE `%s`.`%s%s`", app.DB.Name, t, oldTableSuffix)); err != nil {
+				return err
+			}
+		}
+	}
+
+	app.Log(fmt.Sprintf("Imported '%s' to '%s'", f.DatabaseFile, app.DB.Name))
+
+	return nil
+}
+
+// validateShadowDatabase ensures that the shadow database contains every table created by the dump
+func validateShadowDatabase(db *sql.DB, name string, tables []string) error {
+	if len(tables) == 0 {
+		return errors.New("the database dump does not contain any tables")
+	}
+
+	shadowTables, err := databaseTables(db, name)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tables {
+		if !containsFold(shadowTables, t) {
+			return fmt.Errorf("table '%s' is missing from shadow database '%s'", t, name)
+		}
+	}
+
+	return nil
+}
+
+// replacedTables returns the live tables that will be replaced by a swap: those
+// that are also in the dump, or all of them when dropDatabase is set.
+func replacedTables(tables, liveTables []string, dropDatabase bool) []string {
+	replaced := []string{}
+	for _, t := range liveTables {
+		if dropDatabase || containsFold(tables, t) {
+			replaced = append(replaced, t)
+		}
+	}
+
+	return replaced
+}
+
+// swapStatement returns a single RENAME TABLE statement that moves the live
+// tables that are being replaced to <table>_old, and the shadow tables into the
+// live database, along with the names of the replaced live tables.
+func swapStatement(live, shadow string, tables, liveTables []string, dropDatabase bool) (string, []string, error) {
+	renames := []string{}
+	replaced := replacedTables(tables, liveTables, dropDatabase)
+
+	for _, t := range replaced {
+		if containsFold(tables, t+oldTableSuffix) || containsFold(liveTables, t+oldTableSuffix) {
+			return "", nil, fmt.Errorf("cannot swap table '%s': '%s%s' already exists, rename or drop it first", t, t, oldTableSuffix)
+		}
+		renames = append(renames, fmt.Sprintf("`%s`.`%s` TO `%s`.`%s%s`", live, t, live, t, oldTableSuffix))
+	}
+
+	for _, t := range tables {
+		renames = append(renames, fmt.Sprintf("`%s`.`%s` TO `%s`.`%s`", shadow, t, live, t))
+	}
+
+	return "RENAME TABLE " + strings.Join(renames, ", "), replaced, nil
+}
+
+// containsFold returns whether s contains v, ignoring case (MySQL table names
+// are case-insensitive on some platforms)
+func containsFold(s []string, v string) bool {
+	for _, x := range s {
+		if strings.EqualFold(x, v) {
+			return true
+		}
+	}
+
+	return false
+}
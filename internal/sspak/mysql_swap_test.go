@@ -0,0 +1,57 @@
+package sspak
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSwapStatement(t *testing.T) {
+	stmt, replaced, err := swapStatement("live", "live_ssbak_tmp", []string{"Member", "SiteTree"}, []string{"Member", "Extra"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Member"}, replaced)
+	assert.Equal(t, "RENAME TABLE `live`.`Member` TO `live`.`Member_old`, "+
+		"`live_ssbak_tmp`.`Member` TO `live`.`Member`, "+
+		"`live_ssbak_tmp`.`SiteTree` TO `live`.`SiteTree`", stmt)
+
+	// --drop-db swaps out all live tables
+	stmt, replaced, err = swapStatement("live", "live_ssbak_tmp", []string{"Member"}, []string{"Member", "Extra"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Member", "Extra"}, replaced)
+	assert.Contains(t, stmt, "`live`.`Extra` TO `live`.`Extra_old`")
+
+	// existing _old tables cannot be overwritten
+	_, _, err = swapStatement("live", "live_ssbak_tmp", []string{"Member"}, []string{"Member", "Member_old"}, false)
+	assert.Error(t, err)
+}
+
+func TestPlanSwap(t *testing.T) {
+	plan := &DatabasePlan{Name: "live", ExistingTables: []string{"Member", "Extra"}}
+	plan.planSwap([]string{"Member", "SiteTree"}, false)
+	assert.Equal(t, "live_ssbak_tmp", plan.ShadowDatabase)
+	assert.Equal(t, []string{"SiteTree"}, plan.CreateTables)
+	assert.Equal(t, []string{"Member"}, plan.OverwriteTables)
+	assert.Equal(t, []string{"Extra"}, plan.KeepTables)
+	assert.Empty(t, plan.DropTables)
+	assert.Equal(t, []string{"Member_old"}, plan.OldTables)
+	assert.NoError(t, plan.SwapErr)
+
+	// --drop-db swaps out all live tables, without dropping the database
+	plan = &DatabasePlan{Name: "live", ExistingTables: []string{"Member", "Extra"}}
+	plan.planSwap([]string{"Member"}, true)
+	assert.Equal(t, []string{"Member"}, plan.OverwriteTables)
+	assert.Equal(t, []string{"Extra"}, plan.DropTables)
+	assert.Equal(t, []string{"Member_old", "Extra_old"}, plan.OldTables)
+
+	// the swap is refused when an _old table already exists
+	plan = &DatabasePlan{Name: "live", ExistingTables: []string{"Member", "Member_old"}}
+	plan.planSwap([]string{"Member"}, false)
+	assert.Error(t, plan.SwapErr)
+}
+
+func TestContainsFold(t *testing.T) {
+	assert.True(t, containsFold([]string{"Member", "SiteTree"}, "sitetree"))
+	assert.False(t, containsFold([]string{"Member"}, "Member_old"))
+	assert.False(t, containsFold(nil, "Member"))
+}
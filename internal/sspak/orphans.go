@@ -0,0 +1,273 @@
+package sspak
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// ReferencedOnly limits the archived assets to the files referenced by the
+// database when set (see LoadReferencedAssets)
+var ReferencedOnly *ReferencedAssets
+
+// fileTables are the tables of Silverstripe's File records
+var fileTables = []string{"File", "File_Live", "File_Versions"}
+
+// ReferencedAssets is the set of asset files referenced by File records. Names
+// are relative to the assets directory. Variants of a file (eg: resized images)
+// and files in the protected store are referenced along with the file.
+type ReferencedAssets struct {
+	// paths are the referenced files
+	paths map[string]bool
+
+	// stems are the referenced files without their extensions, to match variants
+	stems map[string]bool
+
+	// names are the base names of the referenced files in each directory, to
+	// match Silverstripe 3 resampled images, eg: Uploads/_resampled/SetWidth100-image.jpg
+	names map[string][]string
+}
+
+// newReferencedAssets returns an empty set of referenced assets
+func newReferencedAssets() *ReferencedAssets {
+	return &ReferencedAssets{
+		paths: map[string]bool{},
+		stems: map[string]bool{},
+		names: map[string][]string{},
+	}
+}
+
+// LoadReferencedAssets queries the File, File_Live and File_Versions tables of
+// the database configured in app.DB for the referenced files. Both the
+// FileFilename & FileHash columns (Silverstripe 4+) and the Filename column
+// (Silverstripe 3) are supported.
+func LoadReferencedAssets() (*ReferencedAssets, error) {
+	db, err := sql.Open("mysql", genMySQLConfig().FormatDSN())
+	if err != nil {
+		return nil, fmt.Errorf("error opening database connection: %s", err.Error())
+	}
+	defer func() { _ = db.Close() }()
+
+	tables, err := databaseTables(db, app.DB.Name)
+	if err != nil {
+		return nil, fmt.Errorf("error reading database tables: %s", err.Error())
+	}
+
+	r := newReferencedAssets()
+	found := false
+
+	for _, table := range fileTables {
+		if !containsFold(tables, table) {
+			continue
+		}
+
+		columns, err := tableColumns(db, app.DB.Name, table)
+		if err != nil {
+			return nil, err
+		}
+
+		var query string
+		switch {
+		case columns["FileFilename"] && columns["FileHash"]:
+			query = fmt.Sprintf("SELECT DISTINCT FileFilename, FileHash FROM `%s` WHERE FileFilename IS NOT NULL AND FileFilename != ''", table)
+		case columns["Filename"]:
+			query = fmt.Sprintf("SELECT DISTINCT Filename, '' FROM `%s` WHERE Filename IS NOT NULL AND Filename != ''", table)
+		default:
+			app.Log(fmt.Sprintf("Table '%s' has no file name columns, skipping", table))
+			continue
+		}
+
+		found = true
+		app.Log(fmt.Sprintf("Reading referenced files from '%s'", table))
+
+		if err := r.query(db, query); err != nil {
+			return nil, fmt.Errorf("error reading '%s': %s", table, err.Error())
+		}
+	}
+
+	if !found {
+		return nil, errors.New("the database does not contain any File tables")
+	}
+
+	app.Log(fmt.Sprintf("Found %d referenced files", len(r.paths)))
+
+	return r, nil
+}
+
+// query adds the file names & hashes returned by query
+func (r *ReferencedAssets) query(db *sql.DB, query string) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var filename string
+		var hash sql.NullString
+		if err := rows.Scan(&filename, &hash); err != nil {
+			return err
+		}
+		r.add(filename, hash.String)
+	}
+
+	return rows.Err()
+}
+
+// add adds a file, and its hashed path when hash is set
+func (r *ReferencedAssets) add(filename, hash string) {
+	// Silverstripe 3 file names include the assets directory
+	name := strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(filename)), "/")
+	name = strings.TrimPrefix(name, "assets/")
+	if name == "" || name == "." {
+		return
+	}
+
+	r.addPath(name)
+
+	if len(hash) >= 10 {
+		dir, base := path.Split(name)
+		r.addPath(dir + hash[:10] + "/" + base)
+	}
+}
+
+// addPath adds a file name
+func (r *ReferencedAssets) addPath(name string) {
+	r.paths[name] = true
+	r.stems[strings.TrimSuffix(name, path.Ext(name))] = true
+
+	dir, base := path.Split(name)
+	r.names[dir] = append(r.names[dir], base)
+}
+
+// Contains returns whether the asset file name (relative to the assets
+// directory) is referenced, or is a variant of a referenced file. Hidden files
+// and web.config files (also within the protected store, where they deny web
+// access) and generated error pages are always kept.
+func (r *ReferencedAssets) Contains(name string) bool {
+	name = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+
+	protected, isProtected := strings.CutPrefix(name, ".protected/")
+
+	// web server rules (eg: .protected/.htaccess) and generated error pages
+	base := path.Base(name)
+	if strings.HasPrefix(base, ".") || base == "web.config" || (!isProtected && strings.HasPrefix(base, "error-") && path.Ext(base) == ".html") {
+		return true
+	}
+
+	if isProtected {
+		name = protected
+	}
+
+	if r.paths[name] {
+		return true
+	}
+
+	dir, base := path.Split(name)
+
+	// variants, eg: Uploads/image__FillWzEwMCwxMDBd.jpg
+	if i := strings.Index(base, "__"); i > 0 {
+		if r.stems[dir+base[:i]] {
+			return true
+		}
+	}
+
+	// Silverstripe 3 resampled images, eg: Uploads/_resampled/SetWidth100-image.jpg
+	if parent, ok := strings.CutSuffix(dir, "_resampled/"); ok {
+		for _, original := range r.names[parent] {
+			if strings.HasSuffix(base, "-"+original) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// tableColumns returns the column names of the given table
+func tableColumns(db *sql.DB, schema, table string) (map[string]bool, error) {
+	rows, err := db.Query("SELECT COLUMN_NAME FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?", schema, table)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	columns := map[string]bool{}
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		columns[c] = true
+	}
+
+	return columns, rows.Err()
+}
+
+// OrphanReport lists the asset files that are not referenced by the database
+type OrphanReport struct {
+	// Files are the unreferenced files, sorted by name
+	Files []AssetEntry
+
+	// OrphanedSize is the total size of the unreferenced files
+	OrphanedSize int64
+
+	// TotalFiles is the number of asset files
+	TotalFiles int
+
+	// TotalSize is the total size of the asset files
+	TotalSize int64
+}
+
+// DirOrphanReport returns the files in the assets directory that are not referenced
+func DirOrphanReport(assetsDir string, referenced *ReferencedAssets) (*OrphanReport, error) {
+	assetsDir, err := filepath.Abs(assetsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	app.Log(fmt.Sprintf("Scanning '%s' for unreferenced files", assetsDir))
+
+	report := &OrphanReport{}
+
+	err = filepath.WalkDir(assetsDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(assetsDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		report.TotalFiles++
+		report.TotalSize += info.Size()
+
+		if !referenced.Contains(rel) {
+			report.Files = append(report.Files, AssetEntry{Name: rel, Size: info.Size(), ModTime: info.ModTime()})
+			report.OrphanedSize += info.Size()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(report.Files, func(i, j int) bool { return report.Files[i].Name < report.Files[j].Name })
+
+	return report, nil
+}
@@ -0,0 +1,100 @@
+package sspak
+
+import (
+	"archive/tar"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReferencedAssetsContains(t *testing.T) {
+	r := newReferencedAssets()
+	r.add("Uploads/image.jpg", "1a2b3c4d5e6f7a8b9c0d")
+	r.add("assets/Legacy/photo.png", "")
+	r.add("", "")
+
+	for _, name := range []string{
+		"Uploads/image.jpg",
+		"Uploads/1a2b3c4d5e/image.jpg",
+		"Uploads/image__FillWzEwMCwxMDBd.jpg",
+		"Uploads/1a2b3c4d5e/image__FitMaxWzM1MiwyNjRd.webp",
+		".protected/Uploads/1a2b3c4d5e/image.jpg",
+		"Legacy/photo.png",
+		"Legacy/_resampled/SetWidth100-photo.png",
+		".htaccess",
+		"Uploads/.htaccess",
+		"web.config",
+		".protected/.htaccess",
+		".protected/web.config",
+		"error-404.html",
+	} {
+		assert.True(t, r.Contains(name), "expected %s to be referenced", name)
+	}
+
+	for _, name := range []string{
+		"Uploads/other.jpg",
+		"Uploads/ffffffffff/image.jpg",
+		"Uploads/other__FillWzEwMCwxMDBd.jpg",
+		"Legacy/_resampled/SetWidth100-other.png",
+		".protected/Uploads/other.jpg",
+		"Other/image.jpg",
+	} {
+		assert.False(t, r.Contains(name), "expected %s to be unreferenced", name)
+	}
+}
+
+func TestOnlyReferencedAssets(t *testing.T) {
+	resetAppState(t)
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	assetsDir := filepath.Join(t.TempDir(), "assets")
+	writeTestFiles(t, assetsDir, map[string]string{
+		".htaccess":                           "deny",
+		"Uploads/image.jpg":                   "image",
+		"Uploads/image__FillWzEwMCwxMDBd.jpg": "thumb",
+		"Uploads/orphan.pdf":                  "orphaned",
+	})
+
+	r := newReferencedAssets()
+	r.add("Uploads/image.jpg", "")
+
+	report, err := DirOrphanReport(assetsDir, r)
+	require.NoError(t, err)
+	assert.Equal(t, 4, report.TotalFiles)
+	require.Len(t, report.Files, 1)
+	assert.Equal(t, "Uploads/orphan.pdf", report.Files[0].Name)
+	assert.Equal(t, int64(8), report.OrphanedSize)
+
+	ReferencedOnly = r
+	t.Cleanup(func() { ReferencedOnly = nil })
+
+	f := &File{TempFolder: t.TempDir()}
+	require.NoError(t, f.AddAssets(assetsDir))
+
+	rawReader, cleanup, err := f.openEntry(f.AssetsFile)
+	require.NoError(t, err)
+	defer cleanup()
+	reader, err := newDecompressReader(rawReader)
+	require.NoError(t, err)
+	defer func() { _ = reader.Close() }()
+
+	names := []string{}
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		if header.Typeflag == tar.TypeReg {
+			names = append(names, assetsRelativePath(header.Name))
+		}
+	}
+
+	assert.ElementsMatch(t, []string{".htaccess", "Uploads/image.jpg", "Uploads/image__FillWzEwMCwxMDBd.jpg"}, names)
+}
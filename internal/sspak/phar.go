@@ -0,0 +1,381 @@
+package sspak
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"crypto/sha1" // #nosec - SHA-1 is the default phar signature
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/utils"
+)
+
+const (
+	// pharMaxStubSize is how far into a file to search for the end of a phar stub
+	pharMaxStubSize = 1 << 20
+
+	// pharAPIVersion is the phar manifest API version (1.1.1)
+	pharAPIVersion = 0x1110
+
+	// pharHasSignature is the global manifest flag for signed phar archives
+	pharHasSignature = 0x00010000
+
+	// pharEntryDeflate is the entry flag for zlib (raw deflate) compressed entries
+	pharEntryDeflate = 0x00001000
+
+	// pharEntryBzip2 is the entry flag for bzip2 compressed entries
+	pharEntryBzip2 = 0x00002000
+
+	// pharSignatureSHA1 is the signature flag for SHA-1 signatures
+	pharSignatureSHA1 = 0x0002
+)
+
+var (
+	// pharHaltCompiler marks the end of the PHP stub of a phar archive
+	pharHaltCompiler = []byte("__HALT_COMPILER();")
+
+	// pharStub is the PHP stub of executable .sspak files created by SSBak
+	pharStub = "<?php\n" +
+		"echo \"This is an executable .sspak archive. Extract or load it with SSBak or SSPak.\\n\";\n" +
+		"__HALT_COMPILER(); ?>\r\n"
+
+	// pharMagic is the end of a signed phar archive
+	pharMagic = []byte("GBMB")
+)
+
+// Executable creates executable (phar) .sspak files, like SSPak's executable
+// archives. This is set using a CLI flag. Phar archives are limited to 4GB per file.
+var Executable bool
+
+// archiveReader iterates over the files of an sspak archive, like tar.Reader
+type archiveReader interface {
+	Next() (*tar.Header, error)
+	Read(p []byte) (int, error)
+}
+
+// newArchiveReader returns a reader for the sspak archive in r, which is either
+// a tar archive or an executable phar archive (a PHP stub with a phar payload).
+func newArchiveReader(r io.ReadSeeker) (archiveReader, error) {
+	offset, err := pharManifestOffset(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	if offset == 0 {
+		return tar.NewReader(r), nil
+	}
+
+	app.Log("Reading executable (phar) .sspak archive")
+
+	return newPharReader(bufio.NewReader(r))
+}
+
+// pharManifestOffset returns the offset of the phar manifest in r, or 0 if r is
+// not a phar archive.
+func pharManifestOffset(r io.ReadSeeker) (int64, error) {
+	head := make([]byte, pharMaxStubSize)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return 0, err
+	}
+	head = head[:n]
+
+	// tar archives have the ustar magic in the first header
+	if len(head) >= 262 && string(head[257:262]) == "ustar" {
+		return 0, nil
+	}
+
+	i := bytes.Index(head, pharHaltCompiler)
+	if i < 0 {
+		return 0, nil
+	}
+
+	// the stub ends with "__HALT_COMPILER(); ?>", optionally followed by a newline
+	offset := i + len(pharHaltCompiler)
+	rest := head[offset:]
+	if len(rest) >= 3 && (rest[0] == ' ' || rest[0] == '\n') && rest[1] == '?' && rest[2] == '>' {
+		offset += 3
+		switch {
+		case bytes.HasPrefix(rest[3:], []byte("\r\n")):
+			offset += 2
+		case bytes.HasPrefix(rest[3:], []byte("\n")):
+			offset++
+		}
+	}
+
+	return int64(offset), nil
+}
+
+// pharEntry is a file in a phar manifest
+type pharEntry struct {
+	name           string
+	size           uint32
+	modTime        uint32
+	compressedSize uint32
+	flags          uint32
+}
+
+// pharReader reads the files of a phar archive. Only top-level files are
+// returned, as the files of an sspak archive are never within a directory (the
+// executable archives of SSPak also contain its PHP source code).
+type pharReader struct {
+	r       *bufio.Reader
+	entries []pharEntry
+
+	// current is the data of the current entry
+	current io.Reader
+
+	// remaining is the unread (compressed) data of the current entry
+	remaining *io.LimitedReader
+}
+
+// newPharReader parses the phar manifest at the start of r
+func newPharReader(r *bufio.Reader) (*pharReader, error) {
+	var manifestLength uint32
+	if err := binary.Read(r, binary.LittleEndian, &manifestLength); err != nil {
+		return nil, fmt.Errorf("invalid phar manifest: %s", err.Error())
+	}
+
+	manifest := make([]byte, manifestLength)
+	if _, err := io.ReadFull(r, manifest); err != nil {
+		return nil, fmt.Errorf("invalid phar manifest: %s", err.Error())
+	}
+
+	m := &pharManifestReader{data: manifest}
+	count := m.uint32()
+	m.skip(2)               // API version
+	m.uint32()              // global flags
+	m.skip(int(m.uint32())) // alias
+	m.skip(int(m.uint32())) // metadata
+
+	p := &pharReader{r: r}
+	for i := uint32(0); i < count && m.err == nil; i++ {
+		e := pharEntry{name: string(m.bytes(int(m.uint32())))}
+		e.size = m.uint32()
+		e.modTime = m.uint32()
+		e.compressedSize = m.uint32()
+		m.uint32() // crc32
+		e.flags = m.uint32()
+		m.skip(int(m.uint32())) // metadata
+		p.entries = append(p.entries, e)
+	}
+
+	if m.err != nil {
+		return nil, errors.New("invalid phar manifest: unexpected end of manifest")
+	}
+
+	return p, nil
+}
+
+// Next advances to the next top-level file in the archive
+func (p *pharReader) Next() (*tar.Header, error) {
+	for len(p.entries) > 0 {
+		// skip the unread data of the previous entry
+		if p.remaining != nil {
+			if _, err := io.Copy(io.Discard, p.remaining); err != nil {
+				return nil, err
+			}
+		}
+
+		e := p.entries[0]
+		p.entries = p.entries[1:]
+		p.remaining = &io.LimitedReader{R: p.r, N: int64(e.compressedSize)}
+
+		name := strings.TrimPrefix(e.name, "/")
+		if strings.Contains(name, "/") || name == "" {
+			continue
+		}
+
+		switch {
+		case e.flags&pharEntryDeflate != 0:
+			p.current = flate.NewReader(p.remaining)
+		case e.flags&pharEntryBzip2 != 0:
+			p.current = bzip2.NewReader(p.remaining)
+		default:
+			p.current = p.remaining
+		}
+
+		return &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Size:     int64(e.size),
+			Mode:     int64(e.flags & 0777),
+			ModTime:  time.Unix(int64(e.modTime), 0),
+		}, nil
+	}
+
+	return nil, io.EOF
+}
+
+// Read reads from the current file
+func (p *pharReader) Read(b []byte) (int, error) {
+	if p.current == nil {
+		return 0, io.EOF
+	}
+
+	return p.current.Read(b)
+}
+
+// pharManifestReader reads little-endian values from a phar manifest,
+// recording an error if the manifest is too short
+type pharManifestReader struct {
+	data []byte
+	err  error
+}
+
+func (m *pharManifestReader) bytes(n int) []byte {
+	if m.err != nil || n < 0 || n > len(m.data) {
+		m.err = io.ErrUnexpectedEOF
+		return nil
+	}
+
+	b := m.data[:n]
+	m.data = m.data[n:]
+
+	return b
+}
+
+func (m *pharManifestReader) uint32() uint32 {
+	b := m.bytes(4)
+	if b == nil {
+		return 0
+	}
+
+	return binary.LittleEndian.Uint32(b)
+}
+
+func (m *pharManifestReader) skip(n int) {
+	m.bytes(n)
+}
+
+// writePhar writes the entries of f to w as an executable, SHA-1
+// signed phar archive.
+func (f *File) writePhar(w io.Writer) error {
+	type file struct {
+		name string
+		size uint32
+		crc  uint32
+	}
+
+	files := []file{}
+	for _, entry := range f.entries() {
+		size, err := f.EntrySize(entry)
+		if err != nil {
+			return err
+		}
+		if size > math.MaxUint32 {
+			return fmt.Errorf("'%s' (%s) is too large for an executable archive (4GB limit)", entry, utils.ByteToHr(size))
+		}
+
+		// the manifest contains the checksums, so the files are read twice
+		crc, err := f.entryChecksum(entry)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, file{name: filepath.Base(entry), size: uint32(size), crc: crc})
+	}
+
+	var manifest bytes.Buffer
+	le := binary.LittleEndian
+	_ = binary.Write(&manifest, le, uint32(len(files)))
+	_ = binary.Write(&manifest, binary.BigEndian, uint16(pharAPIVersion))
+	_ = binary.Write(&manifest, le, uint32(pharHasSignature))
+	_ = binary.Write(&manifest, le, uint32(0)) // alias
+	_ = binary.Write(&manifest, le, uint32(0)) // metadata
+
+	now := uint32(time.Now().Unix())
+	for _, file := range files {
+		_ = binary.Write(&manifest, le, uint32(len(file.name)))
+		manifest.WriteString(file.name)
+		_ = binary.Write(&manifest, le, file.size) // uncompressed size
+		_ = binary.Write(&manifest, le, now)
+		_ = binary.Write(&manifest, le, file.size) // compressed size
+		_ = binary.Write(&manifest, le, file.crc)
+		_ = binary.Write(&manifest, le, uint32(0644))
+		_ = binary.Write(&manifest, le, uint32(0)) // metadata
+	}
+
+	// the signature is the hash of everything before it
+	signature := sha1.New() // #nosec
+	out := io.MultiWriter(w, signature)
+
+	if _, err := io.WriteString(out, pharStub); err != nil {
+		return err
+	}
+	if err := binary.Write(out, le, uint32(manifest.Len())); err != nil {
+		return err
+	}
+	if _, err := out.Write(manifest.Bytes()); err != nil {
+		return err
+	}
+
+	for _, entry := range f.entries() {
+		if err := f.copyEntry(entry, out); err != nil {
+			return err
+		}
+	}
+
+	if _, err := w.Write(signature.Sum(nil)); err != nil {
+		return err
+	}
+	if err := binary.Write(w, le, uint32(pharSignatureSHA1)); err != nil {
+		return err
+	}
+	_, err := w.Write(pharMagic)
+
+	return err
+}
+
+// entryChecksum returns the CRC-32 of the raw contents of entry
+func (f *File) entryChecksum(entry string) (uint32, error) {
+	h := crc32.NewIEEE()
+	if err := f.copyEntry(entry, h); err != nil {
+		return 0, err
+	}
+
+	return h.Sum32(), nil
+}
+
+// copyEntry copies the raw contents of entry to w
+func (f *File) copyEntry(entry string, w io.Writer) error {
+	r, cleanup, err := f.openEntry(entry)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	/* #nosec - file is streamed from sspak archive */
+	_, err = io.Copy(w, r)
+
+	return err
+}
+
+// IsExecutable returns whether sspakFile is an executable (phar) archive
+func IsExecutable(sspakFile string) (bool, error) {
+	file, err := os.Open(filepath.Clean(sspakFile))
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = file.Close() }()
+
+	offset, err := pharManifestOffset(file)
+
+	return offset > 0, err
+}
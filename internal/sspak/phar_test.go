@@ -0,0 +1,135 @@
+package sspak
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteExecutable(t *testing.T) {
+	resetAppState(t)
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+	t.Cleanup(func() { Executable = false })
+
+	f := writeTestAssets(t, map[string]string{"Uploads/file.txt": "content"})
+	f.DatabaseFile = writeCompressedSQL(t, f.TempFolder, testDump, false)
+
+	Executable = true
+	sspakPath := filepath.Join(t.TempDir(), "test.sspak")
+	require.NoError(t, f.Write(sspakPath))
+	Executable = false
+
+	data, err := os.ReadFile(sspakPath)
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte("<?php")))
+	assert.True(t, bytes.HasSuffix(data, pharMagic))
+
+	probed, err := Probe(sspakPath)
+	require.NoError(t, err)
+	assert.Equal(t, "database.sql.gz", probed.DatabaseFile)
+	assert.Equal(t, "assets.tar.gz", probed.AssetsFile)
+
+	var sql bytes.Buffer
+	require.NoError(t, probed.WriteSQL(&sql))
+	assert.Equal(t, testDump, sql.String())
+
+	entries, err := probed.ListAssets(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "Uploads/file.txt", entries[0].Name)
+
+	// executable archives can be converted back to a regular sspak
+	tarPath := filepath.Join(t.TempDir(), "copy.sspak")
+	require.NoError(t, probed.Write(tarPath))
+	assert.Equal(t, readSSPakEntry(t, tarPath, "assets.tar.gz"), mustReadFile(t, f.AssetsFile))
+
+	outDir := t.TempDir()
+	require.NoError(t, Extract(sspakPath, outDir))
+	assert.FileExists(t, filepath.Join(outDir, "database.sql.gz"))
+	assert.FileExists(t, filepath.Join(outDir, "assets.tar.gz"))
+}
+
+func TestReadCompressedPhar(t *testing.T) {
+	resetAppState(t)
+
+	sql := writeCompressedSQL(t, t.TempDir(), testDump, false)
+	dbData := mustReadFile(t, sql)
+
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.BestCompression)
+	require.NoError(t, err)
+	_, err = fw.Write(dbData)
+	require.NoError(t, err)
+	require.NoError(t, fw.Close())
+
+	type entry struct {
+		name  string
+		data  []byte
+		size  int
+		flags uint32
+	}
+
+	// SSPak's executable archives also contain its PHP source code
+	entries := []entry{
+		{name: "src/SSPak.php", data: []byte("<?php // code"), size: 13, flags: 0644},
+		{name: "database.sql.gz", data: compressed.Bytes(), size: len(dbData), flags: 0644 | pharEntryDeflate},
+	}
+
+	var manifest bytes.Buffer
+	le := binary.LittleEndian
+	_ = binary.Write(&manifest, le, uint32(len(entries)))
+	_ = binary.Write(&manifest, binary.BigEndian, uint16(pharAPIVersion))
+	_ = binary.Write(&manifest, le, uint32(0))
+	_ = binary.Write(&manifest, le, uint32(len("sspak.phar")))
+	manifest.WriteString("sspak.phar")
+	_ = binary.Write(&manifest, le, uint32(0))
+	for _, e := range entries {
+		_ = binary.Write(&manifest, le, uint32(len(e.name)))
+		manifest.WriteString(e.name)
+		_ = binary.Write(&manifest, le, uint32(e.size))
+		_ = binary.Write(&manifest, le, uint32(0))
+		_ = binary.Write(&manifest, le, uint32(len(e.data)))
+		_ = binary.Write(&manifest, le, crc32.ChecksumIEEE(e.data))
+		_ = binary.Write(&manifest, le, e.flags)
+		_ = binary.Write(&manifest, le, uint32(0))
+	}
+
+	var phar bytes.Buffer
+	phar.WriteString("#!/usr/bin/env php\n<?php Phar::mapPhar('sspak.phar'); __HALT_COMPILER(); ?>\n")
+	_ = binary.Write(&phar, le, uint32(manifest.Len()))
+	phar.Write(manifest.Bytes())
+	for _, e := range entries {
+		phar.Write(e.data)
+	}
+
+	sspakPath := filepath.Join(t.TempDir(), "sspak.phar")
+	require.NoError(t, os.WriteFile(sspakPath, phar.Bytes(), 0644))
+
+	f, err := Probe(sspakPath)
+	require.NoError(t, err)
+	assert.Equal(t, "database.sql.gz", f.DatabaseFile)
+	assert.Equal(t, "", f.AssetsFile)
+
+	var sqlOut bytes.Buffer
+	require.NoError(t, f.WriteSQL(&sqlOut))
+	assert.Equal(t, testDump, sqlOut.String())
+}
+
+// mustReadFile returns the contents of file
+func mustReadFile(t *testing.T, file string) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+
+	return data
+}
@@ -0,0 +1,203 @@
+package sspak
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/axllent/ssbak/internal/utils"
+)
+
+// AddProtectedAssets adds the protected assets store (see SS_PROTECTED_ASSETS_PATH)
+// as a separate archive entry, compressed like the assets.
+func (f *File) AddProtectedAssets(protectedDir string) error {
+	var err error
+	protectedDir, err = filepath.Abs(protectedDir)
+	if err != nil {
+		return err
+	}
+
+	if !utils.IsDir(protectedDir) {
+		return fmt.Errorf("protected assets directory '%s' does not exist", protectedDir)
+	}
+
+	f.ProtectedAssetsFile, err = f.compressDirectories("protected-assets.tar", []string{protectedDir}, filepath.Dir(protectedDir), nil)
+
+	return err
+}
+
+// AddDirectories adds additional directories within the webroot as a separate
+// archive entry, with paths relative to the webroot.
+func (f *File) AddDirectories(webroot string, dirs []string) error {
+	root, err := filepath.Abs(webroot)
+	if err != nil {
+		return err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return err
+	}
+
+	paths := []string{}
+	for _, dir := range dirs {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(root, dir)
+		}
+
+		if !utils.IsDir(dir) {
+			return fmt.Errorf("directory '%s' does not exist", dir)
+		}
+
+		real, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			return err
+		}
+
+		if real == root || !withinDirectory(real, root) {
+			return fmt.Errorf("directory '%s' must be within the webroot '%s'", dir, root)
+		}
+
+		paths = append(paths, real)
+	}
+
+	f.DirectoriesFile, err = f.compressDirectories("directories.tar", paths, root, nil)
+
+	return err
+}
+
+// LoadProtectedAssets extracts the protected assets into a staging directory
+// next to protectedDir, and then swaps it into place like LoadAssets.
+func (f *File) LoadProtectedAssets(protectedDir string) error {
+	parent := filepath.Dir(protectedDir)
+	if err := os.MkdirAll(parent, 0750); err != nil {
+		return err
+	}
+
+	// the staging directory must be on the same filesystem for an atomic rename
+	staging, err := os.MkdirTemp(parent, ".ssbak-staging-")
+	if err != nil {
+		return err
+	}
+	app.AddTempFile(staging)
+
+	if err := os.Chmod(staging, 0750); err != nil {
+		return err
+	}
+
+	app.Log(fmt.Sprintf("Unpacking '%s' to '%s'", f.ProtectedAssetsFile, staging))
+
+	if _, err := f.extractEntryTo(f.ProtectedAssetsFile, staging, extractOptions{stripTopLevel: true}); err != nil {
+		app.Log(fmt.Sprintf("Extraction failed, removing '%s'", staging))
+		_ = os.RemoveAll(staging)
+		return err
+	}
+
+	if err := swapIntoPlace(staging, protectedDir); err != nil {
+		return err
+	}
+
+	outSize, _ := utils.CalcSize(protectedDir)
+	app.Log(fmt.Sprintf("Restored '%s' (%s)", protectedDir, utils.ByteToHr(outSize)))
+
+	return nil
+}
+
+// MergeProtectedAssets extracts the protected assets directly into protectedDir
+// without removing any existing files. Files that already exist are handled
+// according to policy.
+func (f *File) MergeProtectedAssets(protectedDir string, policy ConflictPolicy) (ExtractStats, error) {
+	app.Log(fmt.Sprintf("Merging '%s' into '%s' (existing files: %s)", f.ProtectedAssetsFile, protectedDir, policy))
+
+	return f.extractEntryTo(f.ProtectedAssetsFile, protectedDir, extractOptions{conflict: policy, stripTopLevel: true})
+}
+
+// LoadDirectories extracts the additional directories into webroot. Existing
+// files are handled according to policy, and other files are left untouched.
+func (f *File) LoadDirectories(webroot string, policy ConflictPolicy) (ExtractStats, error) {
+	app.Log(fmt.Sprintf("Unpacking '%s' to '%s' (existing files: %s)", f.DirectoriesFile, webroot, policy))
+
+	return f.extractEntryTo(f.DirectoriesFile, webroot, extractOptions{conflict: policy})
+}
+
+// directoriesRoots returns the top-level additional directories of the archive,
+// relative to the webroot, eg: public/uploads
+func (f *File) directoriesRoots() ([]string, error) {
+	rawReader, cleanup, err := f.openEntry(f.DirectoriesFile)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	reader, err := newDecompressReader(rawReader)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = reader.Close() }()
+
+	dirs := map[string]bool{}
+	roots := []string{}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag != tar.TypeDir {
+			continue
+		}
+
+		name := strings.Trim(path.Clean("/"+filepath.ToSlash(header.Name)), "/")
+		if name == "" {
+			continue
+		}
+
+		// parent directories precede their contents
+		if !dirs[path.Dir(name)] {
+			roots = append(roots, filepath.FromSlash(name))
+		}
+		dirs[name] = true
+	}
+
+	return roots, nil
+}
+
+// extractEntryTo extracts the compressed tar entry of f into directory
+func (f *File) extractEntryTo(entry, directory string, opts extractOptions) (ExtractStats, error) {
+	r, cleanup, err := f.openEntry(entry)
+	if err != nil {
+		return ExtractStats{}, err
+	}
+	defer cleanup()
+
+	return extractAssetsFromReader(r, directory, opts)
+}
+
+// ProtectedAssetsDir returns the protected assets store of the site: the
+// SS_PROTECTED_ASSETS_PATH if set, otherwise assets/.protected within assetsBase.
+func ProtectedAssetsDir(assetsBase string) string {
+	if app.ProtectedAssetsPath != "" {
+		return app.ProtectedAssetsPath
+	}
+
+	return filepath.Join(assetsBase, "assets", ".protected")
+}
+
+// isProtectedAssetsEntry returns whether name is a protected assets file of an
+// sspak archive, eg: protected-assets.tar.gz
+func isProtectedAssetsEntry(name string) bool {
+	return name == "protected-assets.tar" || strings.HasPrefix(name, "protected-assets.tar.")
+}
+
+// isDirectoriesEntry returns whether name is an additional directories file of
+// an sspak archive, eg: directories.tar.gz
+func isDirectoriesEntry(name string) bool {
+	return name == "directories.tar" || strings.HasPrefix(name, "directories.tar.")
+}
@@ -0,0 +1,91 @@
+package sspak
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestFiles writes files (slash-separated paths relative to dir) with their contents
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0644))
+	}
+}
+
+func TestProtectedAssetsAndDirectories(t *testing.T) {
+	resetAppState(t)
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	protectedDir := filepath.Join(t.TempDir(), "secure-files")
+	writeTestFiles(t, protectedDir, map[string]string{"a1/secret.pdf": "secret"})
+
+	webroot := t.TempDir()
+	writeTestFiles(t, webroot, map[string]string{
+		"app/uploads/report.csv": "csv",
+		"app/src/Page.php":       "<?php",
+	})
+
+	f := &File{TempFolder: t.TempDir()}
+	f.DatabaseFile = writeCompressedSQL(t, f.TempFolder, testDump, false)
+	require.NoError(t, f.AddProtectedAssets(protectedDir))
+	require.NoError(t, f.AddDirectories(webroot, []string{"app/uploads"}))
+
+	sspakPath := filepath.Join(t.TempDir(), "test.sspak")
+	require.NoError(t, f.Write(sspakPath))
+
+	probed, err := Probe(sspakPath)
+	require.NoError(t, err)
+	assert.Equal(t, "protected-assets.tar.gz", probed.ProtectedAssetsFile)
+	assert.Equal(t, "directories.tar.gz", probed.DirectoriesFile)
+
+	// the protected assets are restored to the configured path, whatever its name
+	restoreRoot := t.TempDir()
+	target := filepath.Join(restoreRoot, "protected")
+	writeTestFiles(t, target, map[string]string{"stale.txt": "stale"})
+	require.NoError(t, probed.LoadProtectedAssets(target))
+	assert.FileExists(t, filepath.Join(target, "a1", "secret.pdf"))
+	assert.NoFileExists(t, filepath.Join(target, "stale.txt"))
+
+	stats, err := probed.MergeProtectedAssets(target, ConflictSkip)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Skipped)
+
+	stats, err = probed.LoadDirectories(restoreRoot, ConflictOverwrite)
+	require.NoError(t, err)
+	assert.Equal(t, 1, stats.Added)
+	assert.FileExists(t, filepath.Join(restoreRoot, "app", "uploads", "report.csv"))
+	assert.NoFileExists(t, filepath.Join(restoreRoot, "app", "src", "Page.php"))
+}
+
+func TestAddDirectoriesOutsideWebroot(t *testing.T) {
+	resetAppState(t)
+
+	webroot := t.TempDir()
+	outside := t.TempDir()
+
+	f := &File{TempFolder: t.TempDir()}
+	assert.Error(t, f.AddDirectories(webroot, []string{outside}))
+	assert.Error(t, f.AddDirectories(webroot, []string{"../"}))
+	assert.Error(t, f.AddDirectories(webroot, []string{"missing"}))
+}
+
+func TestProtectedAssetsDir(t *testing.T) {
+	prev := app.ProtectedAssetsPath
+	t.Cleanup(func() { app.ProtectedAssetsPath = prev })
+
+	app.ProtectedAssetsPath = ""
+	assert.Equal(t, filepath.Join("public", "assets", ".protected"), ProtectedAssetsDir("public"))
+
+	app.ProtectedAssetsPath = "/srv/protected"
+	assert.Equal(t, "/srv/protected", ProtectedAssetsDir("public"))
+}
@@ -0,0 +1,122 @@
+package sspak
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// ResampledReport lists the resampled images that --ignore-resampled would drop
+type ResampledReport struct {
+	// Files are the resampled images, sorted by name
+	Files []AssetEntry
+
+	// ResampledSize is the total size of the resampled images
+	ResampledSize int64
+
+	// TotalFiles is the number of asset files
+	TotalFiles int
+
+	// TotalSize is the total size of the asset files
+	TotalSize int64
+}
+
+// add adds an asset file to the report
+func (r *ResampledReport) add(name string, entry AssetEntry) {
+	r.TotalFiles++
+	r.TotalSize += entry.Size
+
+	if isResampled(name) {
+		r.Files = append(r.Files, entry)
+		r.ResampledSize += entry.Size
+	}
+}
+
+// sort sorts the files by name
+func (r *ResampledReport) sort() {
+	sort.Slice(r.Files, func(i, j int) bool { return r.Files[i].Name < r.Files[j].Name })
+}
+
+// ResampledReport returns the resampled images in the assets archive of f
+func (f *File) ResampledReport() (*ResampledReport, error) {
+	rawReader, cleanup, err := f.openEntry(f.AssetsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	reader, err := newDecompressReader(rawReader)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = reader.Close() }()
+
+	app.Log(fmt.Sprintf("Scanning '%s' for resampled images", f.AssetsFile))
+
+	report := &ResampledReport{}
+
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		report.add(header.Name, AssetEntry{Name: assetsRelativePath(header.Name), Size: header.Size, ModTime: header.ModTime})
+	}
+
+	report.sort()
+
+	return report, nil
+}
+
+// DirResampledReport returns the resampled images in the assets directory
+func DirResampledReport(assetsDir string) (*ResampledReport, error) {
+	assetsDir, err := filepath.Abs(assetsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	app.Log(fmt.Sprintf("Scanning '%s' for resampled images", assetsDir))
+
+	report := &ResampledReport{}
+
+	err = filepath.WalkDir(assetsDir, func(p string, d os.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(assetsDir, p)
+		if err != nil {
+			return err
+		}
+
+		report.add(p, AssetEntry{Name: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	report.sort()
+
+	return report, nil
+}
@@ -0,0 +1,56 @@
+package sspak
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustomResampledPatterns(t *testing.T) {
+	resetAppState(t)
+	app.IgnoreResampled = true
+
+	assert.False(t, skipResampled("assets/Uploads/image__WebpWzEwMF0.webp"))
+	assert.True(t, skipResampled("assets/Uploads/image__FillWzEwMF0.jpg"))
+
+	require.NoError(t, app.AddResampledPatterns([]string{`__Webp[a-zA-Z0-9]*\.webp$`}, []string{`/keep/`}))
+
+	assert.True(t, skipResampled("assets/Uploads/image__WebpWzEwMF0.webp"))
+	assert.False(t, skipResampled("assets/keep/image__FillWzEwMF0.jpg"))
+
+	assert.Error(t, app.AddResampledPatterns([]string{`(`}, nil))
+}
+
+func TestResampledReport(t *testing.T) {
+	resetAppState(t)
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	webroot := t.TempDir()
+	writeTestFiles(t, webroot, map[string]string{
+		"assets/Uploads/image.jpg":                     "original",
+		"assets/Uploads/image__FillWzEwMF0.jpg":        "thumb",
+		"assets/Uploads/image__FitMaxWzM1MiwyNjRd.jpg": "cms",
+	})
+	assetsDir := filepath.Join(webroot, "assets")
+
+	report, err := DirResampledReport(assetsDir)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.TotalFiles)
+	assert.Equal(t, int64(16), report.TotalSize)
+	require.Len(t, report.Files, 1)
+	assert.Equal(t, "Uploads/image__FillWzEwMF0.jpg", report.Files[0].Name)
+	assert.Equal(t, int64(5), report.ResampledSize)
+
+	f := &File{TempFolder: t.TempDir()}
+	require.NoError(t, f.AddAssets(assetsDir))
+
+	report, err = f.ResampledReport()
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.TotalFiles)
+	require.Len(t, report.Files, 1)
+	assert.Equal(t, "Uploads/image__FillWzEwMF0.jpg", report.Files[0].Name)
+}
@@ -0,0 +1,427 @@
+package sspak
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseURLRewrite returns the old and new URLs of an `old=new` rewrite
+func ParseURLRewrite(s string) (string, string, error) {
+	from, to, ok := strings.Cut(s, "=")
+	if !ok || from == "" || to == "" {
+		return "", "", fmt.Errorf("invalid URL rewrite '%s', expected <old>=<new>", s)
+	}
+
+	if from == to {
+		return "", "", fmt.Errorf("invalid URL rewrite '%s', the URLs are the same", s)
+	}
+
+	return from, to, nil
+}
+
+// urlRewriter replaces URLs in the string values of INSERT statements during
+// an import. Values containing PHP-serialised data have their string lengths
+// updated, and JSON-escaped URLs (eg: https:\/\/www.example.com) are also
+// replaced.
+type urlRewriter struct {
+	// replacer replaces the URLs in plain text
+	replacer *strings.Replacer
+
+	// olds are the URLs to replace, in both plain and JSON-escaped forms
+	olds []string
+
+	// Rows is the number of rewritten rows per table
+	Rows map[string]int
+}
+
+// newURLRewriter returns a rewriter for the `old=new` rewrites, or nil if there are none
+func newURLRewriter(rewrites []string) (*urlRewriter, error) {
+	if len(rewrites) == 0 {
+		return nil, nil
+	}
+
+	pairs := []string{}
+	olds := []string{}
+	for _, s := range rewrites {
+		from, to, err := ParseURLRewrite(s)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, from, to)
+		olds = append(olds, from)
+
+		if jsonFrom := strings.ReplaceAll(from, "/", `\/`); jsonFrom != from {
+			pairs = append(pairs, jsonFrom, strings.ReplaceAll(to, "/", `\/`))
+			olds = append(olds, jsonFrom)
+		}
+	}
+
+	return &urlRewriter{
+		replacer: strings.NewReplacer(pairs...),
+		olds:     olds,
+		Rows:     map[string]int{},
+	}, nil
+}
+
+// apply returns the statement with the URLs in its string values rewritten.
+// Statements other than INSERTs are returned unchanged.
+func (u *urlRewriter) apply(stmt string) string {
+	m := tableStatementRegex.FindStringSubmatch(stmt)
+	if m == nil || !strings.Contains(strings.ToUpper(m[1]), "INTO") || !u.contains(stmt) {
+		return stmt
+	}
+	table := m[2]
+
+	var b strings.Builder
+	b.Grow(len(stmt))
+
+	depth := 0
+	inValues := false
+	rowChanged := false
+
+	for i := len(m[0]); i < len(stmt); i++ {
+		c := stmt[i]
+		switch {
+		case c == '\'':
+			end, value := readSQLString(stmt, i)
+			if end < 0 {
+				// unterminated string, leave the rest of the statement untouched
+				b.WriteString(stmt[i:])
+				i = len(stmt)
+				continue
+			}
+			if rewritten := u.rewrite(value); rewritten != value {
+				b.WriteString(quoteSQLString(rewritten))
+				rowChanged = true
+			} else {
+				b.WriteString(stmt[i : end+1])
+			}
+			i = end
+			continue
+		case c == '`':
+			end := strings.IndexByte(stmt[i+1:], '`')
+			if end < 0 {
+				b.WriteString(stmt[i:])
+				i = len(stmt)
+				continue
+			}
+			b.WriteString(stmt[i : i+end+2])
+			i += end + 1
+			continue
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 && inValues && rowChanged {
+				u.Rows[table]++
+				rowChanged = false
+			}
+		case depth == 0 && !inValues && (c == 'V' || c == 'v') && strings.EqualFold(stmt[i:min(i+6, len(stmt))], "VALUES"):
+			inValues = true
+		}
+		b.WriteByte(c)
+	}
+
+	return m[0] + b.String()
+}
+
+// contains returns whether s contains any of the URLs to replace
+func (u *urlRewriter) contains(s string) bool {
+	for _, old := range u.olds {
+		if strings.Contains(s, old) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rewrite returns the value with the URLs replaced, updating the lengths of
+// PHP-serialised strings if value is serialised data
+func (u *urlRewriter) rewrite(value string) string {
+	if !u.contains(value) {
+		return value
+	}
+
+	if out, err := u.rewriteSerialized(value); err == nil {
+		return out
+	}
+
+	return u.replacer.Replace(value)
+}
+
+// rewriteSerialized rewrites PHP-serialised data, returning an error if value
+// is not (entirely) serialised data
+func (u *urlRewriter) rewriteSerialized(value string) (string, error) {
+	p := &phpSerialized{in: value, rewrite: u.rewrite}
+	if err := p.value(); err != nil {
+		return "", err
+	}
+
+	if p.pos != len(p.in) {
+		return "", errors.New("trailing data")
+	}
+
+	return p.out.String(), nil
+}
+
+// report prints the number of rewritten rows per table
+func (u *urlRewriter) report() {
+	if u == nil {
+		return
+	}
+
+	tables := []string{}
+	total := 0
+	for t, n := range u.Rows {
+		tables = append(tables, t)
+		total += n
+	}
+	sort.Strings(tables)
+
+	fmt.Printf("Rewrote URLs in %d rows\n", total)
+	for _, t := range tables {
+		fmt.Printf("  %s: %d rows\n", t, u.Rows[t])
+	}
+}
+
+// readSQLString reads the single-quoted SQL string starting at stmt[start],
+// returning the index of the closing quote (or -1) and the unescaped value
+func readSQLString(stmt string, start int) (int, string) {
+	var b strings.Builder
+
+	for i := start + 1; i < len(stmt); i++ {
+		c := stmt[i]
+		switch c {
+		case '\\':
+			if i+1 >= len(stmt) {
+				return -1, ""
+			}
+			i++
+			switch stmt[i] {
+			case '0':
+				b.WriteByte(0)
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'b':
+				b.WriteByte('\b')
+			case 'Z':
+				b.WriteByte(0x1a)
+			case '%', '_':
+				// LIKE wildcards keep their backslash
+				b.WriteByte('\\')
+				b.WriteByte(stmt[i])
+			default:
+				b.WriteByte(stmt[i])
+			}
+		case '\'':
+			if i+1 < len(stmt) && stmt[i+1] == '\'' {
+				b.WriteByte('\'')
+				i++
+				continue
+			}
+			return i, b.String()
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return -1, ""
+}
+
+// quoteSQLString returns the value as a single-quoted SQL string, escaped like mysqldump
+func quoteSQLString(value string) string {
+	var b strings.Builder
+	b.Grow(len(value) + 2)
+	b.WriteByte('\'')
+
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case 0:
+			b.WriteString(`\0`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case 0x1a:
+			b.WriteString(`\Z`)
+		case '\\', '\'', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	b.WriteByte('\'')
+
+	return b.String()
+}
+
+// phpSerialized rewrites the strings of PHP-serialised data (see serialize()),
+// updating their lengths. Nested serialised strings are rewritten recursively.
+type phpSerialized struct {
+	in      string
+	pos     int
+	out     strings.Builder
+	rewrite func(string) string
+}
+
+// value rewrites a single serialised value
+func (p *phpSerialized) value() error {
+	if p.pos >= len(p.in) {
+		return errors.New("unexpected end of data")
+	}
+
+	switch p.in[p.pos] {
+	case 'N':
+		return p.copy("N;")
+	case 'b', 'i', 'd', 'r', 'R':
+		// eg: i:123;
+		end := strings.IndexByte(p.in[p.pos:], ';')
+		if end < 2 || p.in[p.pos+1] != ':' {
+			return errors.New("invalid scalar")
+		}
+		p.out.WriteString(p.in[p.pos : p.pos+end+1])
+		p.pos += end + 1
+		return nil
+	case 's':
+		// eg: s:5:"hello";
+		if err := p.expect("s:"); err != nil {
+			return err
+		}
+		s, err := p.lengthString('"', '"')
+		if err != nil {
+			return err
+		}
+		s = p.rewrite(s)
+		p.out.WriteString(`s:` + strconv.Itoa(len(s)) + `:"` + s + `"`)
+		return p.copy(";")
+	case 'a':
+		// eg: a:1:{i:0;s:1:"a";}
+		n, err := p.header("a:")
+		if err != nil {
+			return err
+		}
+		return p.members(n * 2)
+	case 'O':
+		// eg: O:8:"stdClass":1:{s:1:"a";i:1;}
+		if err := p.expect("O:"); err != nil {
+			return err
+		}
+		class, err := p.lengthString('"', '"')
+		if err != nil {
+			return err
+		}
+		p.out.WriteString(`O:` + strconv.Itoa(len(class)) + `:"` + class + `"`)
+		n, err := p.header(":")
+		if err != nil {
+			return err
+		}
+		return p.members(n * 2)
+	case 'C':
+		// eg: C:11:"ArrayObject":21:{x:i:0;a:0:{};m:a:0:{}}
+		if err := p.expect("C:"); err != nil {
+			return err
+		}
+		class, err := p.lengthString('"', '"')
+		if err != nil {
+			return err
+		}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		data, err := p.lengthString('{', '}')
+		if err != nil {
+			return err
+		}
+		data = p.rewrite(data)
+		p.out.WriteString(`C:` + strconv.Itoa(len(class)) + `:"` + class + `":` + strconv.Itoa(len(data)) + `:{` + data + `}`)
+		return nil
+	}
+
+	return fmt.Errorf("invalid type '%c'", p.in[p.pos])
+}
+
+// header copies a `<prefix><n>:{` header and returns n
+func (p *phpSerialized) header(prefix string) (int, error) {
+	if err := p.copy(prefix); err != nil {
+		return 0, err
+	}
+
+	n, err := p.number()
+	if err != nil {
+		return 0, err
+	}
+	p.out.WriteString(strconv.Itoa(n))
+
+	return n, p.copy(":{")
+}
+
+// members rewrites n values followed by the closing brace
+func (p *phpSerialized) members(n int) error {
+	for i := 0; i < n; i++ {
+		if err := p.value(); err != nil {
+			return err
+		}
+	}
+
+	return p.copy("}")
+}
+
+// lengthString reads `<len>:<open><len bytes><close>`, returning the bytes
+func (p *phpSerialized) lengthString(open, closing byte) (string, error) {
+	n, err := p.number()
+	if err != nil {
+		return "", err
+	}
+
+	if p.pos+1 >= len(p.in) || p.in[p.pos] != ':' || p.in[p.pos+1] != open {
+		return "", errors.New("invalid string")
+	}
+	start := p.pos + 2
+	end := start + n
+	if end >= len(p.in) || p.in[end] != closing {
+		return "", errors.New("invalid string length")
+	}
+	p.pos = end + 1
+
+	return p.in[start:end], nil
+}
+
+// number reads a non-negative integer
+func (p *phpSerialized) number() (int, error) {
+	start := p.pos
+	for p.pos < len(p.in) && p.in[p.pos] >= '0' && p.in[p.pos] <= '9' {
+		p.pos++
+	}
+
+	return strconv.Atoi(p.in[start:p.pos])
+}
+
+// expect skips s without writing it
+func (p *phpSerialized) expect(s string) error {
+	if !strings.HasPrefix(p.in[p.pos:], s) {
+		return fmt.Errorf("expected '%s'", s)
+	}
+	p.pos += len(s)
+
+	return nil
+}
+
+// copy copies s to the output
+func (p *phpSerialized) copy(s string) error {
+	if err := p.expect(s); err != nil {
+		return err
+	}
+	p.out.WriteString(s)
+
+	return nil
+}
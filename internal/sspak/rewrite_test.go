@@ -0,0 +1,70 @@
+package sspak
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseURLRewrite(t *testing.T) {
+	from, to, err := ParseURLRewrite("https://www.example.com=https://staging.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "https://www.example.com", from)
+	assert.Equal(t, "https://staging.example.com", to)
+
+	for _, s := range []string{"", "https://www.example.com", "=https://x", "https://x=", "https://x=https://x"} {
+		_, _, err := ParseURLRewrite(s)
+		assert.Error(t, err, "expected an error for '%s'", s)
+	}
+}
+
+func TestURLRewriterApply(t *testing.T) {
+	u, err := newURLRewriter([]string{"https://www.example.com=https://staging.example.com"})
+	require.NoError(t, err)
+
+	stmt := "INSERT INTO `SiteTree` (`ID`, `Content`) VALUES " +
+		`(1,'<a href=\"https://www.example.com/about\">It\'s here</a>'),` +
+		`(2,'no links'),` +
+		`(3,'{\"url\":\"https:\\/\\/www.example.com\\/\"}\n');`
+
+	expected := "INSERT INTO `SiteTree` (`ID`, `Content`) VALUES " +
+		`(1,'<a href=\"https://staging.example.com/about\">It\'s here</a>'),` +
+		`(2,'no links'),` +
+		`(3,'{\"url\":\"https:\\/\\/staging.example.com\\/\"}\n');`
+
+	assert.Equal(t, expected, u.apply(stmt))
+	assert.Equal(t, map[string]int{"SiteTree": 2}, u.Rows)
+
+	// other statements are untouched
+	create := "CREATE TABLE `SiteTree` (`Content` text DEFAULT 'https://www.example.com');"
+	assert.Equal(t, create, u.apply(create))
+}
+
+func TestURLRewriterSerialized(t *testing.T) {
+	u, err := newURLRewriter([]string{"https://www.example.com=https://example.test"})
+	require.NoError(t, err)
+
+	nested := `s:24:"https://www.example.com/";`
+	value := `a:3:{s:3:"url";s:27:"https://www.example.com/a/b";i:0;O:8:"stdClass":1:{s:1:"n";s:32:"` + nested + `";}i:1;b:1;}`
+
+	expected := `a:3:{s:3:"url";s:24:"https://example.test/a/b";i:0;O:8:"stdClass":1:{s:1:"n";s:29:"s:21:"https://example.test/";";}i:1;b:1;}`
+	assert.Equal(t, expected, u.rewrite(value))
+
+	// invalid lengths are treated as plain text
+	assert.Equal(t, `s:1:"https://example.test";`, u.rewrite(`s:1:"https://www.example.com";`))
+}
+
+func TestSQLStringQuoting(t *testing.T) {
+	stmt := `'a\'b''c\\d\ne\0f\%'`
+	end, value := readSQLString(stmt, 0)
+	assert.Equal(t, len(stmt)-1, end)
+	assert.Equal(t, "a'b'c\\d\ne\x00f\\%", value)
+
+	end, value = readSQLString(quoteSQLString(value), 0)
+	assert.Greater(t, end, 0)
+	assert.Equal(t, "a'b'c\\d\ne\x00f\\%", value)
+
+	end, _ = readSQLString(`'unterminated`, 0)
+	assert.Equal(t, -1, end)
+}
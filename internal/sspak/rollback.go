@@ -0,0 +1,300 @@
+package sspak
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// Rollback is a snapshot of the current database and/or assets, taken before
+// a restore so they can be reinstated should the restore fail.
+type Rollback struct {
+	// Path is the location of the rollback .sspak file
+	Path string
+
+	// archive is the probed rollback .sspak
+	archive *File
+
+	// databaseExisted is whether the database existed when the snapshot was taken
+	databaseExisted bool
+
+	// assetsExisted is whether the assets directory existed when the snapshot was taken
+	assetsExisted bool
+
+	// protectedDir is the protected assets store restored outside the assets
+	// directory (see SS_PROTECTED_ASSETS_PATH), if any
+	protectedDir string
+
+	// protectedExisted is whether protectedDir existed when the snapshot was taken
+	protectedExisted bool
+
+	// webroot is the webroot of the additional directories
+	webroot string
+
+	// directories are the additional directories restored, relative to webroot
+	directories []string
+}
+
+// CreateRollback snapshots the current database (withDatabase), and the assets
+// directory in assetsBase along with the protected assets store and additional
+// directories restored by archive (withAssets), into a rollback .sspak in the
+// system temporary directory. The rollback file is deliberately not registered
+// for cleanup so that it survives an interrupted restore; use Discard once it
+// is no longer needed.
+func CreateRollback(archive *File, assetsBase string, withDatabase, withAssets bool) (*Rollback, error) {
+	r := &Rollback{
+		Path:    filepath.Join(os.TempDir(), fmt.Sprintf("ssbak-rollback-%s.sspak", time.Now().Format("20060102-150405"))),
+		webroot: app.ProjectRoot,
+	}
+
+	snapshot := &File{TempFolder: filepath.Join(app.GetTempDir(), "rollback")}
+	if err := os.MkdirAll(snapshot.TempFolder, 0750); err != nil {
+		return nil, err
+	}
+
+	if withDatabase {
+		config := genMySQLConfig()
+		config.DBName = ""
+
+		adminDB, err := sql.Open("mysql", config.FormatDSN())
+		if err != nil {
+			return nil, fmt.Errorf("error opening database connection: %s", err.Error())
+		}
+
+		r.databaseExisted, err = databaseExists(adminDB, app.DB.Name)
+		_ = adminDB.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		if r.databaseExisted {
+			app.Log(fmt.Sprintf("Creating rollback snapshot of database '%s'", app.DB.Name))
+			if err := snapshot.AddDatabase(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	assetsPath := filepath.Join(assetsBase, "assets")
+	if withAssets && IsDir(assetsPath) {
+		r.assetsExisted = true
+
+		// AddAssets refuses empty directories, and there is nothing to snapshot
+		if entries, _ := os.ReadDir(assetsPath); len(entries) > 0 {
+			// the snapshot must be complete, regardless of --ignore-resampled and the asset filters
+			defer unfiltered()()
+
+			app.Log(fmt.Sprintf("Creating rollback snapshot of '%s'", assetsPath))
+			if err := snapshot.AddAssets(assetsPath); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if withAssets {
+		if err := r.snapshotAssetDirectories(archive, snapshot, assetsBase); err != nil {
+			return nil, err
+		}
+	}
+
+	if snapshot.DatabaseFile == "" && snapshot.AssetsFile == "" && snapshot.ProtectedAssetsFile == "" && snapshot.DirectoriesFile == "" {
+		app.Log("Nothing to snapshot, no rollback file created")
+		r.archive = snapshot
+		r.Path = ""
+		return r, nil
+	}
+
+	if err := snapshot.Write(r.Path); err != nil {
+		_ = os.Remove(r.Path)
+		return nil, err
+	}
+
+	probed, err := Probe(r.Path)
+	if err != nil {
+		return nil, err
+	}
+	r.archive = probed
+
+	fmt.Printf("Rollback snapshot saved to '%s'\n", r.Path)
+
+	return r, nil
+}
+
+// snapshotAssetDirectories adds the protected assets store (when outside the
+// assets directory) and the additional directories restored by archive to snapshot
+func (r *Rollback) snapshotAssetDirectories(archive *File, snapshot *File, assetsBase string) error {
+	defer unfiltered()()
+
+	if archive.ProtectedAssetsFile != "" {
+		protectedDir, err := filepath.Abs(ProtectedAssetsDir(assetsBase))
+		if err != nil {
+			return err
+		}
+		assetsPath, err := filepath.Abs(filepath.Join(assetsBase, "assets"))
+		if err != nil {
+			return err
+		}
+
+		real := protectedDir
+		if resolved, err := filepath.EvalSymlinks(protectedDir); err == nil {
+			real = resolved
+		}
+
+		// a protected store within the assets directory is part of the assets snapshot
+		if !withinDirectory(real, assetsPath) {
+			r.protectedDir = protectedDir
+			r.protectedExisted = IsDir(protectedDir)
+
+			if r.protectedExisted {
+				app.Log(fmt.Sprintf("Creating rollback snapshot of '%s'", protectedDir))
+				if err := snapshot.AddProtectedAssets(protectedDir); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if archive.DirectoriesFile != "" {
+		directories, err := archive.directoriesRoots()
+		if err != nil {
+			return err
+		}
+		r.directories = directories
+
+		existing := []string{}
+		for _, dir := range directories {
+			if IsDir(filepath.Join(r.webroot, dir)) {
+				existing = append(existing, dir)
+			}
+		}
+
+		if len(existing) > 0 {
+			app.Log(fmt.Sprintf("Creating rollback snapshot of '%s'", strings.Join(existing, "', '")))
+			if err := snapshot.AddDirectories(r.webroot, existing); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Restore reinstates the snapshot of the database (restoreDatabase) and/or the
+// assets in assetsBase (restoreAssets). The rollback file is removed when the
+// restore succeeds, and kept otherwise.
+func (r *Rollback) Restore(assetsBase string, restoreDatabase, restoreAssets bool) error {
+	fmt.Println("Restore failed, rolling back to the snapshot taken before the restore")
+
+	if err := r.restore(assetsBase, restoreDatabase, restoreAssets); err != nil {
+		if r.Path != "" {
+			return fmt.Errorf("rollback failed: %s (the snapshot has been kept in '%s')", err.Error(), r.Path)
+		}
+		return fmt.Errorf("rollback failed: %s", err.Error())
+	}
+
+	fmt.Println("Rollback complete")
+
+	return r.Discard()
+}
+
+func (r *Rollback) restore(assetsBase string, restoreDatabase, restoreAssets bool) error {
+	if restoreDatabase {
+		// the snapshot contains all tables, regardless of --table, and is restored as it was
+		tables, intoTable, rewriteURLs := app.Tables, app.IntoTable, app.RewriteURLs
+		app.Tables, app.IntoTable, app.RewriteURLs = nil, "", nil
+		defer func() { app.Tables, app.IntoTable, app.RewriteURLs = tables, intoTable, rewriteURLs }()
+
+		if r.databaseExisted {
+			if err := r.archive.LoadDatabase(true); err != nil {
+				return err
+			}
+		} else if err := dropDatabase(app.DB.Name); err != nil {
+			return err
+		}
+	}
+
+	if restoreAssets {
+		assetsPath := filepath.Join(assetsBase, "assets")
+
+		// remove the partially restored assets
+		app.Log(fmt.Sprintf("Removing '%s'", assetsPath))
+		if err := os.RemoveAll(assetsPath); err != nil {
+			return err
+		}
+
+		if r.archive.AssetsFile != "" {
+			defer unfiltered()()
+
+			if err := r.archive.LoadAssets(assetsBase); err != nil {
+				return err
+			}
+		} else if r.assetsExisted {
+			// the original assets directory was empty
+			if err := os.MkdirAll(assetsPath, 0750); err != nil {
+				return err
+			}
+		}
+
+		if err := r.restoreAssetDirectories(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreAssetDirectories reinstates the snapshot of the protected assets store
+// and additional directories, removing those created by the failed restore
+func (r *Rollback) restoreAssetDirectories() error {
+	defer unfiltered()()
+
+	if r.protectedDir != "" {
+		app.Log(fmt.Sprintf("Removing '%s'", r.protectedDir))
+		if err := os.RemoveAll(r.protectedDir); err != nil {
+			return err
+		}
+
+		if r.archive.ProtectedAssetsFile != "" {
+			if err := r.archive.LoadProtectedAssets(r.protectedDir); err != nil {
+				return err
+			}
+		} else if r.protectedExisted {
+			// the original protected assets store was empty
+			if err := os.MkdirAll(r.protectedDir, 0750); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, dir := range r.directories {
+		dirPath := filepath.Join(r.webroot, dir)
+		app.Log(fmt.Sprintf("Removing '%s'", dirPath))
+		if err := os.RemoveAll(dirPath); err != nil {
+			return err
+		}
+	}
+
+	if r.archive.DirectoriesFile != "" {
+		if _, err := r.archive.LoadDirectories(r.webroot, ConflictOverwrite); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Discard deletes the rollback file
+func (r *Rollback) Discard() error {
+	if r.Path == "" {
+		return nil
+	}
+
+	app.Log(fmt.Sprintf("Deleting rollback snapshot '%s'", r.Path))
+
+	return os.Remove(r.Path)
+}
@@ -0,0 +1,155 @@
+package sspak
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/axllent/ssbak/app"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRollbackAssets(t *testing.T) {
+	resetAppState(t)
+	t.Setenv("TMPDIR", t.TempDir())
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	app.IgnoreResampled = true
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+	defer func() { app.IgnoreResampled = false }()
+
+	base := t.TempDir()
+	assetsDir := filepath.Join(base, "assets")
+	require.NoError(t, os.MkdirAll(assetsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "photo.jpg"), []byte("original"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "photo__FillWzgwLDgwXQ.jpg"), []byte("thumb"), 0644))
+
+	rollback, err := CreateRollback(&File{}, base, false, true)
+	require.NoError(t, err)
+	assert.FileExists(t, rollback.Path)
+
+	// simulate a partially restored assets directory
+	require.NoError(t, os.RemoveAll(assetsDir))
+	require.NoError(t, os.MkdirAll(assetsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "partial.jpg"), []byte("partial"), 0644))
+
+	require.NoError(t, rollback.Restore(base, false, true))
+
+	got, err := os.ReadFile(filepath.Join(assetsDir, "photo.jpg"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("original"), got)
+	// resampled images are always part of the snapshot
+	assert.FileExists(t, filepath.Join(assetsDir, "photo__FillWzgwLDgwXQ.jpg"))
+	assert.NoFileExists(t, filepath.Join(assetsDir, "partial.jpg"))
+	assert.NoFileExists(t, rollback.Path, "rollback file should be removed after a successful rollback")
+	assert.True(t, app.IgnoreResampled, "IgnoreResampled should be restored")
+}
+
+func TestRollbackAssetsNotExisting(t *testing.T) {
+	resetAppState(t)
+	t.Setenv("TMPDIR", t.TempDir())
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+
+	base := t.TempDir()
+
+	rollback, err := CreateRollback(&File{}, base, false, true)
+	require.NoError(t, err)
+	assert.Empty(t, rollback.Path)
+
+	// assets created by the failed restore are removed
+	assetsDir := filepath.Join(base, "assets")
+	require.NoError(t, os.MkdirAll(assetsDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "partial.jpg"), []byte("partial"), 0644))
+
+	require.NoError(t, rollback.Restore(base, false, true))
+	assert.NoDirExists(t, assetsDir)
+}
+
+func TestRollbackAssetsIgnoresFilters(t *testing.T) {
+	resetAppState(t)
+	t.Setenv("TMPDIR", t.TempDir())
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	app.Excludes = []string{"*.pdf"}
+	app.ExcludeLargerThan = 4
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+
+	base := t.TempDir()
+	assetsDir := filepath.Join(base, "assets")
+	writeTestFiles(t, assetsDir, map[string]string{
+		ignoreFile:         "*.doc\n",
+		"photo.jpg":        "jpg",
+		"report.pdf":       "pdf",
+		"large.jpg":        "large file",
+		"Uploads/memo.doc": "doc",
+	})
+
+	rollback, err := CreateRollback(&File{}, base, false, true)
+	require.NoError(t, err)
+
+	// simulate a partially restored assets directory
+	require.NoError(t, os.RemoveAll(assetsDir))
+	writeTestFiles(t, assetsDir, map[string]string{"partial.jpg": "partial"})
+
+	require.NoError(t, rollback.Restore(base, false, true))
+
+	for _, name := range []string{ignoreFile, "photo.jpg", "report.pdf", "large.jpg", "Uploads/memo.doc"} {
+		assert.FileExists(t, filepath.Join(assetsDir, filepath.FromSlash(name)))
+	}
+	assert.NoFileExists(t, filepath.Join(assetsDir, "partial.jpg"))
+	assert.Equal(t, []string{"*.pdf"}, app.Excludes, "the filters should be restored")
+	assert.False(t, filtersDisabled)
+}
+
+func TestRollbackAssetDirectories(t *testing.T) {
+	resetAppState(t)
+	t.Setenv("TMPDIR", t.TempDir())
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+	Compression = CompressionOptions{Algorithm: CompressionGzip}
+	prevRoot, prevProtected := app.ProjectRoot, app.ProtectedAssetsPath
+	t.Cleanup(func() { app.ProjectRoot, app.ProtectedAssetsPath = prevRoot, prevProtected })
+
+	// the archive being restored
+	source := t.TempDir()
+	writeTestFiles(t, source, map[string]string{
+		"protected/a1/new.pdf":   "new",
+		"app/uploads/report.csv": "new",
+		"app/uploads/new.csv":    "new",
+	})
+	f := &File{TempFolder: t.TempDir()}
+	require.NoError(t, f.AddProtectedAssets(filepath.Join(source, "protected")))
+	require.NoError(t, f.AddDirectories(source, []string{"app/uploads"}))
+	sspakPath := filepath.Join(t.TempDir(), "test.sspak")
+	require.NoError(t, f.Write(sspakPath))
+	archive, err := Probe(sspakPath)
+	require.NoError(t, err)
+
+	webroot := t.TempDir()
+	app.ProjectRoot = webroot
+	app.ProtectedAssetsPath = filepath.Join(webroot, "secure")
+	writeTestFiles(t, webroot, map[string]string{
+		"secure/a1/old.pdf":      "old",
+		"app/uploads/report.csv": "old",
+		"app/src/Page.php":       "php",
+	})
+
+	rollback, err := CreateRollback(archive, webroot, false, true)
+	require.NoError(t, err)
+	assert.FileExists(t, rollback.Path)
+
+	// simulate a restore failing after the protected assets & directories
+	require.NoError(t, archive.LoadProtectedAssets(app.ProtectedAssetsPath))
+	_, err = archive.LoadDirectories(webroot, ConflictOverwrite)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(webroot, "app", "uploads", "new.csv"))
+
+	require.NoError(t, rollback.Restore(webroot, false, true))
+
+	assert.FileExists(t, filepath.Join(webroot, "secure", "a1", "old.pdf"))
+	assert.NoFileExists(t, filepath.Join(webroot, "secure", "a1", "new.pdf"))
+	got, err := os.ReadFile(filepath.Join(webroot, "app", "uploads", "report.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "old", string(got))
+	assert.NoFileExists(t, filepath.Join(webroot, "app", "uploads", "new.csv"))
+	assert.FileExists(t, filepath.Join(webroot, "app", "src", "Page.php"))
+	assert.NoDirExists(t, filepath.Join(webroot, "assets"))
+}
@@ -0,0 +1,151 @@
+package sspak
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// createTableRegex matches the table name of a CREATE TABLE statement
+var createTableRegex = regexp.MustCompile("(?i)^\\s*CREATE\\s+TABLE\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?`([^`]+)`")
+
+// tableStatementRegex matches statements operating on a single table, capturing
+// the statement prefix and the table name
+var tableStatementRegex = regexp.MustCompile("(?i)^(\\s*(?:DROP\\s+TABLE\\s+(?:IF\\s+EXISTS\\s+)?|CREATE\\s+TABLE\\s+(?:IF\\s+NOT\\s+EXISTS\\s+)?|LOCK\\s+TABLES\\s+|INSERT\\s+(?:IGNORE\\s+)?INTO\\s+|REPLACE\\s+INTO\\s+|ALTER\\s+TABLE\\s+))`([^`]+)`")
+
+// scanStatements reads an SQL dump from r and calls fn for every complete
+// statement. Comments, conditional comments and blank lines are skipped.
+func scanStatements(r io.Reader, fn func(stmt string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Split(bufio.ScanLines)
+	buf := make([]byte, 0, bufio.MaxScanTokenSize)
+	// ~32MB buffer to handle very long lines
+	scanner.Buffer(buf, bufio.MaxScanTokenSize*500)
+
+	stmt := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "/*!") || strings.HasPrefix(line, "--") || line == "":
+			// skip comments and blank lines
+		case strings.HasSuffix(line, ";"):
+			stmt += line + " "
+			if strings.TrimSpace(stmt) != "" {
+				if err := fn(stmt); err != nil {
+					return err
+				}
+			}
+			stmt = ""
+		default:
+			stmt += "\n" + line
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(stmt) != "" {
+		return fn(stmt)
+	}
+
+	return nil
+}
+
+// dumpTables returns the names of all tables created by the SQL dump in r,
+// in the order they appear.
+func dumpTables(r io.Reader) ([]string, error) {
+	tables := []string{}
+
+	err := scanStatements(r, func(stmt string) error {
+		if m := createTableRegex.FindStringSubmatch(stmt); m != nil {
+			tables = append(tables, m[1])
+		}
+		return nil
+	})
+
+	return tables, err
+}
+
+// tableFilter limits an import to the tables matching any of its patterns,
+// optionally importing the (single) matching table under a different name.
+type tableFilter struct {
+	// patterns are table names, supporting glob wildcards (eg: SiteTree*)
+	patterns []string
+
+	// into is the table name to import the matching table as
+	into string
+
+	// matched is the first table matched when into is set
+	matched string
+}
+
+// newTableFilter returns a tableFilter for the patterns, or nil if there are none
+func newTableFilter(patterns []string, into string) *tableFilter {
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	return &tableFilter{patterns: patterns, into: into}
+}
+
+// matches returns whether the table matches any of the filter patterns (case-insensitive)
+func (t *tableFilter) matches(table string) bool {
+	for _, p := range t.patterns {
+		if ok, _ := path.Match(strings.ToLower(p), strings.ToLower(table)); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// apply returns the statement to execute: statements for other tables return
+// an empty string, and statements for the matching table are renamed when
+// into is set. Statements not specific to a table are returned unchanged.
+func (t *tableFilter) apply(stmt string) (string, error) {
+	m := tableStatementRegex.FindStringSubmatchIndex(stmt)
+	if m == nil {
+		return stmt, nil
+	}
+
+	table := stmt[m[4]:m[5]]
+	if !t.matches(table) {
+		return "", nil
+	}
+
+	if t.into == "" {
+		return stmt, nil
+	}
+
+	if t.matched == "" {
+		t.matched = table
+	} else if t.matched != table {
+		return "", fmt.Errorf("--into-table requires a single table, but '%s' and '%s' both match", t.matched, table)
+	}
+
+	return stmt[:m[4]] + t.into + stmt[m[5]:], nil
+}
+
+// filterStatements writes the statements of the SQL dump in r that pass the
+// filter to w, one per line, and returns the names of the tables created.
+func filterStatements(r io.Reader, w io.Writer, filter *tableFilter) ([]string, error) {
+	tables := []string{}
+
+	err := scanStatements(r, func(stmt string) error {
+		stmt, err := filter.apply(stmt)
+		if err != nil || stmt == "" {
+			return err
+		}
+		if m := createTableRegex.FindStringSubmatch(stmt); m != nil {
+			tables = append(tables, m[1])
+		}
+		_, err = io.WriteString(w, strings.TrimSpace(stmt)+"\n")
+		return err
+	})
+
+	return tables, err
+}
@@ -0,0 +1,106 @@
+package sspak
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDump = "-- Go SQL Dump\n" +
+	"/*!40101 SET NAMES utf8mb4 */;\n" +
+	"\n" +
+	"DROP TABLE IF EXISTS `Member`;\n" +
+	"CREATE TABLE `Member` (\n" +
+	"  `ID` int NOT NULL,\n" +
+	"  `Email` varchar(255)\n" +
+	");\n" +
+	"LOCK TABLES `Member` WRITE;\n" +
+	"INSERT INTO `Member` VALUES (1,'a@example.com'),(2,'b@example.com');\n" +
+	"UNLOCK TABLES;\n" +
+	"DROP TABLE IF EXISTS `SiteTree`;\n" +
+	"CREATE TABLE `SiteTree` (\n" +
+	"  `ID` int NOT NULL\n" +
+	");\n" +
+	"INSERT INTO `SiteTree` VALUES (1);\n"
+
+func TestScanStatements(t *testing.T) {
+	stmts := []string{}
+	require.NoError(t, scanStatements(strings.NewReader(testDump), func(stmt string) error {
+		stmts = append(stmts, strings.TrimSpace(stmt))
+		return nil
+	}))
+
+	require.Len(t, stmts, 8)
+	assert.Equal(t, "DROP TABLE IF EXISTS `Member`;", stmts[0])
+	assert.True(t, strings.HasPrefix(stmts[1], "CREATE TABLE `Member` ("))
+	assert.Contains(t, stmts[1], "`Email` varchar(255)")
+	assert.Equal(t, "INSERT INTO `SiteTree` VALUES (1);", stmts[7])
+}
+
+func TestScanStatementsUnterminated(t *testing.T) {
+	stmts := []string{}
+	require.NoError(t, scanStatements(strings.NewReader("SELECT 1;\nSELECT\n2"), func(stmt string) error {
+		stmts = append(stmts, strings.TrimSpace(stmt))
+		return nil
+	}))
+
+	assert.Equal(t, []string{"SELECT 1;", "SELECT\n2"}, stmts)
+}
+
+func TestDumpTables(t *testing.T) {
+	tables, err := dumpTables(strings.NewReader(testDump))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Member", "SiteTree"}, tables)
+}
+
+func TestTableFilter(t *testing.T) {
+	filter := newTableFilter([]string{"member", "Site*"}, "")
+
+	stmts := []string{}
+	require.NoError(t, scanStatements(strings.NewReader(testDump+
+		"DROP TABLE IF EXISTS `File`;\nCREATE TABLE `File` (\n  `ID` int\n);\nINSERT INTO `File` VALUES (1);\n"), func(stmt string) error {
+		stmt, err := filter.apply(stmt)
+		if stmt != "" {
+			stmts = append(stmts, strings.TrimSpace(stmt))
+		}
+		return err
+	}))
+
+	for _, stmt := range stmts {
+		assert.NotContains(t, stmt, "`File`")
+	}
+	assert.Contains(t, stmts, "UNLOCK TABLES;", "statements without a table are kept")
+	assert.Contains(t, stmts, "INSERT INTO `SiteTree` VALUES (1);")
+	assert.Len(t, stmts, 8)
+
+	assert.Nil(t, newTableFilter(nil, ""))
+}
+
+func TestTableFilterInto(t *testing.T) {
+	filter := newTableFilter([]string{"Member"}, "Member_restored")
+
+	stmt, err := filter.apply("DROP TABLE IF EXISTS `Member`;")
+	require.NoError(t, err)
+	assert.Equal(t, "DROP TABLE IF EXISTS `Member_restored`;", stmt)
+
+	stmt, err = filter.apply("\nCREATE TABLE `Member` (\n  `ID` int\n);")
+	require.NoError(t, err)
+	assert.Equal(t, "\nCREATE TABLE `Member_restored` (\n  `ID` int\n);", stmt)
+
+	stmt, err = filter.apply("INSERT INTO `Member` VALUES (1,'`Member`');")
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT INTO `Member_restored` VALUES (1,'`Member`');", stmt)
+
+	stmt, err = filter.apply("INSERT INTO `SiteTree` VALUES (1);")
+	require.NoError(t, err)
+	assert.Empty(t, stmt)
+
+	// only a single table can be renamed
+	filter = newTableFilter([]string{"Site*"}, "Restored")
+	_, err = filter.apply("DROP TABLE IF EXISTS `SiteTree`;")
+	require.NoError(t, err)
+	_, err = filter.apply("DROP TABLE IF EXISTS `SiteConfig`;")
+	assert.Error(t, err)
+}
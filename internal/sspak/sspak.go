@@ -3,6 +3,7 @@ package sspak
 
 import (
 	"archive/tar"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -13,18 +14,27 @@ import (
 	"github.com/axllent/ssbak/internal/utils"
 )
 
-var (
-	// UseZSTD indicates whether to use ZSTD compression for compression.
-	// This is set using a CLI flag, and makes the output sspak file incompatible with the official sspak tool.
-	UseZSTD bool
-)
-
 // File represents a .sspak file, containing paths to the database and assets files.
 type File struct {
 	DatabaseFile string
 	AssetsFile   string
 	TempFolder   string // TempFolder is used for processing the files before creating the final .sspak file.
 	SourceSSPak  string // SourceSSPak is set when streaming directly from the archive (no temp files).
+
+	// GitRemoteFile is the git-remote entry, recording the repository and commit of the site code
+	GitRemoteFile string
+
+	// ProtectedAssetsFile is the protected assets store (see SS_PROTECTED_ASSETS_PATH)
+	ProtectedAssetsFile string
+
+	// DirectoriesFile contains additional directories, relative to the webroot
+	DirectoriesFile string
+
+	// CodeFile is the code archive of the webroot
+	CodeFile string
+
+	// sources maps entry names to the sspak files they are streamed from, overriding SourceSSPak
+	sources map[string]string
 }
 
 // New creates a new File struct with the given name and a temporary path for processing.
@@ -61,26 +71,36 @@ func Open(sspakFile string) (*File, error) {
 
 	f := &File{TempFolder: tempFolder}
 
-	for _, name := range []string{"database.sql.gz", "database.sql.zst"} {
-		candidate := filepath.Join(tempFolder, name)
-		if utils.IsFile(candidate) {
-			f.DatabaseFile = candidate
-			break
-		}
+	entries, err := os.ReadDir(tempFolder)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, name := range []string{"assets.tar.gz", "assets.tar.zst"} {
-		candidate := filepath.Join(tempFolder, name)
-		if utils.IsFile(candidate) {
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		candidate := filepath.Join(tempFolder, entry.Name())
+		if f.DatabaseFile == "" && isDatabaseEntry(entry.Name()) {
+			f.DatabaseFile = candidate
+		} else if f.AssetsFile == "" && isAssetsEntry(entry.Name()) {
 			f.AssetsFile = candidate
-			break
+		} else if f.ProtectedAssetsFile == "" && isProtectedAssetsEntry(entry.Name()) {
+			f.ProtectedAssetsFile = candidate
+		} else if f.DirectoriesFile == "" && isDirectoriesEntry(entry.Name()) {
+			f.DirectoriesFile = candidate
+		} else if f.CodeFile == "" && isCodeEntry(entry.Name()) {
+			f.CodeFile = candidate
+		} else if entry.Name() == gitRemoteEntry {
+			f.GitRemoteFile = candidate
 		}
 	}
 
 	return f, nil
 }
 
-// Probe opens an sspak file, reads only the tar headers to discover what entries
+// Probe opens an sspak file (tar or executable phar), reads only the headers to discover what entries
 // are present, and returns a File with DatabaseFile/AssetsFile set to the entry
 // names (not real file paths). SourceSSPak is set so that LoadDatabase and
 // LoadAssets can stream directly from the archive without writing temp files.
@@ -99,7 +119,10 @@ func Probe(sspakFile string) (*File, error) {
 		}
 	}()
 
-	tr := tar.NewReader(r)
+	tr, err := newArchiveReader(r)
+	if err != nil {
+		return nil, err
+	}
 	f := &File{SourceSSPak: sspakFile}
 
 	for {
@@ -111,11 +134,19 @@ func Probe(sspakFile string) (*File, error) {
 			return nil, err
 		}
 
-		switch header.Name {
-		case "database.sql.gz", "database.sql.zst":
+		switch {
+		case isDatabaseEntry(header.Name):
 			f.DatabaseFile = header.Name
-		case "assets.tar.gz", "assets.tar.zst":
+		case isAssetsEntry(header.Name):
 			f.AssetsFile = header.Name
+		case isProtectedAssetsEntry(header.Name):
+			f.ProtectedAssetsFile = header.Name
+		case isDirectoriesEntry(header.Name):
+			f.DirectoriesFile = header.Name
+		case isCodeEntry(header.Name):
+			f.CodeFile = header.Name
+		case header.Name == gitRemoteEntry:
+			f.GitRemoteFile = header.Name
 		}
 
 		// Discard entry data to advance to the next header.
@@ -131,24 +162,36 @@ func Probe(sspakFile string) (*File, error) {
 // reader positioned at the start of that entry's data. The caller must invoke
 // the returned cleanup func when done to close the underlying file.
 func openSSPakEntry(sspakFile, entryName string) (io.Reader, func(), error) {
+	_, r, cleanup, err := openSSPakEntryHeader(sspakFile, entryName)
+
+	return r, cleanup, err
+}
+
+// openSSPakEntryHeader is openSSPakEntry, also returning the tar header of the entry.
+func openSSPakEntryHeader(sspakFile, entryName string) (*tar.Header, io.Reader, func(), error) {
 	f, err := os.Open(filepath.Clean(sspakFile))
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
+	}
+
+	tr, err := newArchiveReader(f)
+	if err != nil {
+		_ = f.Close()
+		return nil, nil, nil, err
 	}
 
-	tr := tar.NewReader(f)
 	for {
 		header, err := tr.Next()
 		if err == io.EOF {
 			_ = f.Close()
-			return nil, nil, fmt.Errorf("entry '%s' not found in '%s'", entryName, sspakFile)
+			return nil, nil, nil, fmt.Errorf("entry '%s' not found in '%s'", entryName, sspakFile)
 		}
 		if err != nil {
 			_ = f.Close()
-			return nil, nil, err
+			return nil, nil, nil, err
 		}
 		if header.Name == entryName {
-			return tr, func() {
+			return header, tr, func() {
 				if err := f.Close(); err != nil {
 					fmt.Printf("Error closing file: %s\n", err)
 				}
@@ -157,9 +200,65 @@ func openSSPakEntry(sspakFile, entryName string) (io.Reader, func(), error) {
 		// Skip this entry's data to advance to the next header.
 		if _, err := io.Copy(io.Discard, tr); err != nil {
 			_ = f.Close()
-			return nil, nil, err
+			return nil, nil, nil, err
+		}
+	}
+}
+
+// entries returns the (non-empty) entries of f
+func (f *File) entries() []string {
+	entries := []string{}
+	for _, entry := range []string{f.DatabaseFile, f.AssetsFile, f.ProtectedAssetsFile, f.DirectoriesFile, f.CodeFile, f.GitRemoteFile} {
+		if entry != "" {
+			entries = append(entries, entry)
 		}
 	}
+
+	return entries
+}
+
+// entrySource returns the sspak file that entry is streamed from, if any
+func (f *File) entrySource(entry string) string {
+	if src, ok := f.sources[entry]; ok {
+		return src
+	}
+
+	return f.SourceSSPak
+}
+
+// openEntry returns a reader for the raw contents of entry, streamed from its
+// source sspak when set, otherwise opened from the (temporary) file path.
+// The caller must invoke the returned cleanup func when done.
+func (f *File) openEntry(entry string) (io.Reader, func(), error) {
+	if src := f.entrySource(entry); src != "" {
+		return openSSPakEntry(src, entry)
+	}
+
+	file, err := os.Open(filepath.Clean(entry))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return file, func() {
+		if err := file.Close(); err != nil {
+			fmt.Printf("Error closing file: %s\n", err)
+		}
+	}, nil
+}
+
+// entryReadCloser wraps a decompressed entry reader so that closing it also
+// releases the underlying file.
+type entryReadCloser struct {
+	io.ReadCloser
+	cleanup func()
+}
+
+// Close closes the decompressor and the underlying file.
+func (r *entryReadCloser) Close() error {
+	err := r.ReadCloser.Close()
+	r.cleanup()
+
+	return err
 }
 
 // Extract extracts the raw contents of an sspak file directly into outputDir.
@@ -183,6 +282,8 @@ func Extract(sspakFile, outputDir string) error {
 
 // extractSSPakContents extracts the outer sspak tar into outDir,
 // skipping the assets or database file when the OnlyDB/OnlyAssets flags are set.
+// The database is written as plain SQL (database.sql) when the Decompress flag is set,
+// and the assets are expanded into outDir/assets when the Unpack flag is set.
 func extractSSPakContents(sspakFile, outDir string) error {
 	r, err := os.Open(filepath.Clean(sspakFile))
 	if err != nil {
@@ -195,7 +296,10 @@ func extractSSPakContents(sspakFile, outDir string) error {
 		}
 	}()
 
-	tr := tar.NewReader(r)
+	tr, err := newArchiveReader(r)
+	if err != nil {
+		return err
+	}
 
 	for {
 		header, err := tr.Next()
@@ -206,10 +310,11 @@ func extractSSPakContents(sspakFile, outDir string) error {
 			return err
 		}
 
-		isAssets := header.Name == "assets.tar.gz" || header.Name == "assets.tar.zst"
-		isDatabase := header.Name == "database.sql.gz" || header.Name == "database.sql.zst"
+		isAssets := isAssetsEntry(header.Name)
+		isDatabase := isDatabaseEntry(header.Name)
+		isFiles := isAssets || isProtectedAssetsEntry(header.Name) || isDirectoriesEntry(header.Name)
 
-		if isAssets && app.OnlyDB {
+		if isFiles && app.OnlyDB {
 			app.Log(fmt.Sprintf("Skipping extraction of '%s' (--db)", header.Name))
 			continue
 		}
@@ -220,6 +325,26 @@ func extractSSPakContents(sspakFile, outDir string) error {
 
 		target := filepath.Join(outDir, filepath.Clean(header.Name))
 
+		if isDatabase && app.Decompress && header.Typeflag == tar.TypeReg {
+			target = filepath.Join(outDir, "database.sql")
+			if err := writeDecompressed(tr, target); err != nil {
+				return err
+			}
+			outSize, _ := utils.CalcSize(target)
+			app.Log(fmt.Sprintf("Extracted '%s' (%s)", target, utils.ByteToHr(outSize)))
+			continue
+		}
+
+		if isAssets && app.Unpack && header.Typeflag == tar.TypeReg {
+			app.Log(fmt.Sprintf("Unpacking '%s' to '%s'", header.Name, filepath.Join(outDir, "assets")))
+			stats, err := extractAssetsFromReader(tr, outDir, extractOptions{})
+			if err != nil {
+				return err
+			}
+			app.Log(fmt.Sprintf("Extracted %d asset files", stats.Added+stats.Overwritten))
+			continue
+		}
+
 		switch header.Typeflag {
 		case tar.TypeDir:
 			if err := os.MkdirAll(target, os.FileMode(header.Mode)); err != nil {
@@ -246,10 +371,52 @@ func extractSSPakContents(sspakFile, outDir string) error {
 	return nil
 }
 
+// writeDecompressed decompresses r (zstd or gzip) into the file target
+func writeDecompressed(r io.Reader, target string) error {
+	reader, err := newDecompressReader(r)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	f, err := os.Create(filepath.Clean(target))
+	if err != nil {
+		return err
+	}
+
+	/* #nosec - file is streamed from sspak archive */
+	if _, err := io.Copy(f, reader); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// WriteSQL writes the decompressed SQL dump of f.DatabaseFile to w
+func (f *File) WriteSQL(w io.Writer) error {
+	if f.DatabaseFile == "" {
+		return errors.New("no database file found")
+	}
+
+	reader, err := f.openDatabaseReader()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = reader.Close() }()
+
+	app.Log(fmt.Sprintf("Decompressing '%s'", f.DatabaseFile))
+
+	_, err = io.Copy(w, reader)
+
+	return err
+}
+
 // Write creates the .sspak file with the given name, using the database and assets files specified in the File struct.
+// Entries of a source sspak (see Probe and Merge) are copied as-is, without decompression.
 // It returns an error if the file could not be created.
 func (f *File) Write(fileName string) error {
-	if f.AssetsFile == "" && f.DatabaseFile == "" {
+	if f.AssetsFile == "" && f.DatabaseFile == "" && f.ProtectedAssetsFile == "" && f.DirectoriesFile == "" {
 		return fmt.Errorf("no database or assets file to include in the .sspak archive")
 	}
 
@@ -259,11 +426,8 @@ func (f *File) Write(fileName string) error {
 	app.Log(fmt.Sprintf("Creating .sspak file '%s'", fileName))
 
 	var inSize int64
-	for _, f := range []string{f.DatabaseFile, f.AssetsFile} {
-		if f == "" {
-			continue
-		}
-		size, err := utils.CalcSize(f)
+	for _, entry := range f.entries() {
+		size, err := f.EntrySize(entry)
 		if err != nil {
 			return err
 		}
@@ -291,15 +455,28 @@ func (f *File) Write(fileName string) error {
 		}
 	}()
 
+	if Executable {
+		if err := f.writePhar(file); err != nil {
+			return fmt.Errorf("could not write '%s': %s", fileName, err.Error())
+		}
+		outSize, _ := utils.CalcSize(fileName)
+		app.Log(fmt.Sprintf("Wrote executable '%s' (%s)", fileName, utils.ByteToHr(outSize)))
+
+		return nil
+	}
+
 	tarWriter := tar.NewWriter(file)
 
-	for _, f := range []string{f.DatabaseFile, f.AssetsFile} {
-		if f == "" {
-			continue
+	for _, entry := range f.entries() {
+		if src := f.entrySource(entry); src != "" {
+			err = copySSPakEntry(src, entry, tarWriter)
+		} else {
+			err = writeFileToSSPak(entry, tarWriter)
 		}
-		if err := writeFileToSSPak(f, tarWriter); err != nil {
+
+		if err != nil {
 			_ = tarWriter.Close()
-			return fmt.Errorf("could not add '%s' to '%s': %s", f, fileName, err.Error())
+			return fmt.Errorf("could not add '%s' to '%s': %s", entry, fileName, err.Error())
 		}
 	}
 
@@ -314,6 +491,49 @@ func (f *File) Write(fileName string) error {
 	return nil
 }
 
+// EntrySize returns the (compressed) size of entry
+func (f *File) EntrySize(entry string) (int64, error) {
+	src := f.entrySource(entry)
+	if src == "" {
+		return utils.CalcSize(entry)
+	}
+
+	header, _, cleanup, err := openSSPakEntryHeader(src, entry)
+	if err != nil {
+		return 0, err
+	}
+	cleanup()
+
+	return header.Size, nil
+}
+
+// copySSPakEntry streams the named entry of the sspak file src into tarWriter
+func copySSPakEntry(src, entry string, tarWriter *tar.Writer) error {
+	header, r, cleanup, err := openSSPakEntryHeader(src, entry)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	app.Log(fmt.Sprintf("Copying '%s' from '%s'", entry, src))
+
+	if err := tarWriter.WriteHeader(&tar.Header{
+		Name:    header.Name,
+		Size:    header.Size,
+		Mode:    header.Mode,
+		ModTime: header.ModTime,
+	}); err != nil {
+		return fmt.Errorf("could not write header '%s': %s", entry, err.Error())
+	}
+
+	/* #nosec - file is streamed from sspak archive */
+	if _, err := io.Copy(tarWriter, r); err != nil {
+		return fmt.Errorf("could not copy '%s' from '%s': %s", entry, src, err.Error())
+	}
+
+	return nil
+}
+
 func writeFileToSSPak(fileName string, tarWriter *tar.Writer) error {
 	fileName = filepath.Clean(fileName)
 
@@ -1,11 +1,15 @@
 package sspak
 
 import (
+	"bytes"
+	"compress/gzip"
+	"io"
 	"os"
 	"path/filepath"
 	"testing"
 
 	"github.com/axllent/ssbak/app"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -16,13 +20,52 @@ func resetAppState(t *testing.T) {
 	prev := app.TempDir
 	prevOnlyDB := app.OnlyDB
 	prevOnlyAssets := app.OnlyAssets
+	prevDecompress := app.Decompress
+	prevUnpack := app.Unpack
+	prevIgnoreResampled := app.IgnoreResampled
+	prevIncludes, prevExcludes, prevExcludeLargerThan := app.Includes, app.Excludes, app.ExcludeLargerThan
+	prevResampledRegex, prevResampledExceptions := app.ResampledRegex, app.ResampledExceptions
 	t.Cleanup(func() {
 		app.TempDir = prev
 		app.OnlyDB = prevOnlyDB
 		app.OnlyAssets = prevOnlyAssets
+		app.Decompress = prevDecompress
+		app.Unpack = prevUnpack
+		app.IgnoreResampled = prevIgnoreResampled
+		app.Includes, app.Excludes, app.ExcludeLargerThan = prevIncludes, prevExcludes, prevExcludeLargerThan
+		app.ResampledRegex, app.ResampledExceptions = prevResampledRegex, prevResampledExceptions
 	})
 	app.OnlyDB = false
 	app.OnlyAssets = false
+	app.Decompress = false
+	app.Unpack = false
+	app.IgnoreResampled = false
+	app.Includes, app.Excludes, app.ExcludeLargerThan = nil, nil, 0
+}
+
+// writeCompressedSQL writes sql to a database.sql.gz or database.sql.zst file in dir
+func writeCompressedSQL(t *testing.T, dir, sql string, isZSTD bool) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	name := "database.sql.gz"
+	if isZSTD {
+		name = "database.sql.zst"
+		enc, err := zstd.NewWriter(&buf)
+		require.NoError(t, err)
+		w = enc
+	} else {
+		w = gzip.NewWriter(&buf)
+	}
+	_, err := w.Write([]byte(sql))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	dbFile := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(dbFile, buf.Bytes(), 0644))
+
+	return dbFile
 }
 
 func TestWriteAndOpen(t *testing.T) {
@@ -157,3 +200,73 @@ func TestExtractSSPakContentsOnlyAssets(t *testing.T) {
 	assert.NoFileExists(t, filepath.Join(outDir, "database.sql.gz"))
 	assert.FileExists(t, filepath.Join(outDir, "assets.tar.gz"))
 }
+
+func TestExtractSSPakContentsDecompress(t *testing.T) {
+	for _, isZSTD := range []bool{false, true} {
+		resetAppState(t)
+		app.Decompress = true
+
+		tmpDir := t.TempDir()
+		dbFile := writeCompressedSQL(t, tmpDir, testDump, isZSTD)
+
+		sspakPath := filepath.Join(tmpDir, "source.sspak")
+		f := &File{DatabaseFile: dbFile, TempFolder: tmpDir}
+		require.NoError(t, f.Write(sspakPath))
+
+		outDir := t.TempDir()
+		require.NoError(t, extractSSPakContents(sspakPath, outDir))
+
+		assert.NoFileExists(t, filepath.Join(outDir, filepath.Base(dbFile)))
+		got, err := os.ReadFile(filepath.Join(outDir, "database.sql"))
+		require.NoError(t, err)
+		assert.Equal(t, testDump, string(got))
+	}
+}
+
+func TestWriteSQL(t *testing.T) {
+	for _, isZSTD := range []bool{false, true} {
+		resetAppState(t)
+
+		tmpDir := t.TempDir()
+		dbFile := writeCompressedSQL(t, tmpDir, testDump, isZSTD)
+
+		sspakPath := filepath.Join(tmpDir, "source.sspak")
+		f := &File{DatabaseFile: dbFile, TempFolder: tmpDir}
+		require.NoError(t, f.Write(sspakPath))
+
+		archive, err := Probe(sspakPath)
+		require.NoError(t, err)
+
+		var buf bytes.Buffer
+		require.NoError(t, archive.WriteSQL(&buf))
+		assert.Equal(t, testDump, buf.String())
+	}
+}
+
+func TestExtractSSPakContentsUnpack(t *testing.T) {
+	resetAppState(t)
+	app.TempDir = filepath.Join(t.TempDir(), "tmp")
+
+	assetsDir := filepath.Join(t.TempDir(), "assets")
+	require.NoError(t, os.MkdirAll(filepath.Join(assetsDir, "Uploads"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "Uploads", "file.txt"), []byte("content"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(assetsDir, "Uploads", "photo__FillWzgwLDgwXQ.jpg"), []byte("thumb"), 0644))
+
+	f := New()
+	require.NoError(t, f.AddAssets(assetsDir))
+
+	sspakPath := filepath.Join(t.TempDir(), "source.sspak")
+	require.NoError(t, f.Write(sspakPath))
+
+	app.Unpack = true
+	app.IgnoreResampled = true
+
+	outDir := t.TempDir()
+	require.NoError(t, extractSSPakContents(sspakPath, outDir))
+
+	assert.NoFileExists(t, filepath.Join(outDir, "assets.tar.gz"))
+	got, err := os.ReadFile(filepath.Join(outDir, "assets", "Uploads", "file.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, []byte("content"), got)
+	assert.NoFileExists(t, filepath.Join(outDir, "assets", "Uploads", "photo__FillWzgwLDgwXQ.jpg"))
+}
@@ -3,7 +3,6 @@ package sspak
 import (
 	"archive/tar"
 	"bufio"
-	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
@@ -13,21 +12,84 @@ import (
 	"syscall"
 
 	"github.com/axllent/ssbak/app"
-	"github.com/klauspost/compress/zstd"
 )
 
-// extractAssets extracts a compressed assets archive (tar.gz or tar.zst) into directory.
-// The format is detected by the file extension of filePath.
-func extractAssets(filePath, directory string) error {
+// ConflictPolicy determines how existing files are handled when extracting assets
+type ConflictPolicy string
+
+const (
+	// ConflictOverwrite always overwrites existing files
+	ConflictOverwrite ConflictPolicy = "overwrite"
+
+	// ConflictSkip never overwrites existing files
+	ConflictSkip ConflictPolicy = "skip"
+
+	// ConflictNewer only overwrites existing files that are older than the archived file
+	ConflictNewer ConflictPolicy = "newer"
+)
+
+// ParseConflictPolicy returns the ConflictPolicy for the given name
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	switch p := ConflictPolicy(strings.ToLower(name)); p {
+	case ConflictOverwrite, ConflictSkip, ConflictNewer:
+		return p, nil
+	}
+
+	return "", fmt.Errorf("invalid conflict policy '%s' (skip, newer or overwrite)", name)
+}
+
+// keepExisting returns whether policy leaves the existing file untouched
+// rather than replacing it with the archived file
+func (policy ConflictPolicy) keepExisting(header *tar.Header, existing os.FileInfo) bool {
+	return policy == ConflictSkip ||
+		(policy == ConflictNewer && !header.ModTime.After(existing.ModTime()))
+}
+
+// ExtractStats are the file counts of an assets extraction
+type ExtractStats struct {
+	// Added are files that did not exist
+	Added int
+
+	// Skipped are existing files that were left untouched
+	Skipped int
+
+	// Overwritten are existing files that were replaced
+	Overwritten int
+}
+
+// extractOptions control how extractAssetsFromReader handles archive entries
+type extractOptions struct {
+	// conflict is the policy for files that already exist (default ConflictOverwrite)
+	conflict ConflictPolicy
+
+	// match optionally limits the extraction to the entries it returns true for
+	match func(name string) bool
+
+	// symlinks restores symbolic links, rather than writing them as (empty) files
+	symlinks bool
+
+	// keepResampled extracts resampled images even when app.IgnoreResampled is set
+	keepResampled bool
+
+	// stripTopLevel extracts the contents of the top-level directory, rather than the directory itself
+	stripTopLevel bool
+
+	// filter optionally skips excluded asset files
+	filter *assetsFilter
+}
+
+// extractAssets extracts a compressed assets archive (eg: tar.gz or tar.zst) into directory.
+// The compression is detected from the file contents (see newDecompressReader).
+func extractAssets(filePath, directory string, opts extractOptions) (ExtractStats, error) {
 	var err error
 	filePath, err = filepath.Abs(filepath.Clean(filePath))
 	if err != nil {
-		return err
+		return ExtractStats{}, err
 	}
 
 	file, err := os.Open(filePath)
 	if err != nil {
-		return err
+		return ExtractStats{}, err
 	}
 	defer func() {
 		if err := file.Close(); err != nil {
@@ -35,21 +97,22 @@ func extractAssets(filePath, directory string) error {
 		}
 	}()
 
-	return extractAssetsFromReader(file, strings.HasSuffix(filePath, ".tar.zst"), directory)
+	return extractAssetsFromReader(file, directory, opts)
 }
 
 // extractAssetsFromReader extracts a compressed assets tar archive from r into directory.
-// isZSTD selects zstd decompression; otherwise gzip is assumed.
-func extractAssetsFromReader(r io.Reader, isZSTD bool, directory string) (err error) {
+// The compression is detected from the stream.
+// Existing files are handled according to opts.conflict.
+func extractAssetsFromReader(r io.Reader, directory string, opts extractOptions) (stats ExtractStats, err error) {
 	directory = stripTrailingSlash(directory)
 	directory, err = filepath.Abs(directory)
 	if err != nil {
-		return err
+		return stats, err
 	}
 
 	undoDir, err := mkdirAll(directory, 0750)
 	if err != nil {
-		return err
+		return stats, err
 	}
 	defer func() {
 		if err != nil {
@@ -57,23 +120,13 @@ func extractAssetsFromReader(r io.Reader, isZSTD bool, directory string) (err er
 		}
 	}()
 
-	var tarReader *tar.Reader
-
-	if isZSTD {
-		zstdDecoder, err := zstd.NewReader(r)
-		if err != nil {
-			return err
-		}
-		defer zstdDecoder.Close()
-		tarReader = tar.NewReader(zstdDecoder)
-	} else {
-		gzipReader, err := gzip.NewReader(bufio.NewReader(r))
-		if err != nil {
-			return err
-		}
-		defer func() { _ = gzipReader.Close() }()
-		tarReader = tar.NewReader(gzipReader)
+	reader, err := newDecompressReader(r)
+	if err != nil {
+		return stats, err
 	}
+	defer func() { _ = reader.Close() }()
+
+	tarReader := tar.NewReader(reader)
 
 	// Post extraction directory permissions & timestamps
 	type dirInfo struct {
@@ -88,7 +141,7 @@ func extractAssetsFromReader(r io.Reader, isZSTD bool, directory string) (err er
 			break
 		}
 		if err != nil {
-			return err
+			return stats, err
 		}
 
 		fileInfo := header.FileInfo()
@@ -97,35 +150,96 @@ func extractAssetsFromReader(r io.Reader, isZSTD bool, directory string) (err er
 		// verify it sits within the extraction directory. String-matching on
 		// header.Name alone misses absolute paths, mixed separators, and other
 		// bypass tricks — only the resolved path is trustworthy.
-		filename := filepath.Join(directory, filepath.FromSlash(header.Name))
+		name := header.Name
+		if opts.stripTopLevel {
+			if name = assetsRelativePath(name); name == "" {
+				continue
+			}
+		}
+
+		filename := filepath.Join(directory, filepath.FromSlash(name))
 		if !strings.HasPrefix(filename+string(os.PathSeparator), filepath.Clean(directory)+string(os.PathSeparator)) {
 			continue
 		}
 		dir := filepath.Dir(filename)
 
-		if skipResampled(filename) {
+		if !opts.keepResampled && skipResampled(filename) {
+			continue
+		}
+
+		if opts.match != nil && !opts.match(header.Name) {
+			continue
+		}
+
+		if fileInfo.IsDir() && opts.filter.skipDir(assetsRelativePath(header.Name)) {
+			continue
+		}
+		if !fileInfo.IsDir() && opts.filter.skipFile(assetsRelativePath(header.Name), header.Size) {
 			continue
 		}
 
 		if fileInfo.IsDir() {
+			if IsDir(filename) && opts.conflict != ConflictOverwrite && opts.conflict != "" {
+				// leave existing directories untouched when merging
+				continue
+			}
 			if err := os.MkdirAll(filename, 0750); err != nil {
-				return err
+				return stats, err
 			}
 			_ = os.Chown(filename, header.Uid, header.Gid) // #nosec
 			postExtraction = append(postExtraction, dirInfo{filename, header})
 			continue
 		}
 
+		existing, statErr := os.Lstat(filename)
+		if statErr == nil && opts.conflict.keepExisting(header, existing) {
+			stats.Skipped++
+			continue
+		}
+
+		// files are only counted once written
+		count := func() {
+			if statErr == nil {
+				stats.Overwritten++
+			} else {
+				stats.Added++
+			}
+		}
+
 		// ensure parent directory exists (may not be present in tar)
 		if !IsDir(dir) {
 			if err := os.MkdirAll(dir, 0750); err != nil {
-				return err
+				return stats, err
+			}
+		}
+
+		if opts.symlinks || opts.conflict != "" {
+			// never write through an extracted or existing symlink pointing outside the directory
+			if realDir, err := filepath.EvalSymlinks(dir); err != nil || !withinDirectory(realDir, directory) {
+				app.Log(fmt.Sprintf("Skipping '%s' as its directory is outside '%s'", name, directory))
+				continue
+			}
+		}
+
+		if opts.symlinks && header.Typeflag == tar.TypeSymlink {
+			_ = os.Remove(filename)
+			if err := os.Symlink(header.Linkname, filename); err != nil {
+				return stats, err
+			}
+			count()
+			continue
+		}
+
+		// replace an existing symlink rather than writing to its target
+		if statErr == nil && existing.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(filename); err != nil {
+				return stats, err
 			}
 		}
 
 		f, err := os.Create(filename) // #nosec
 		if err != nil {
-			return err
+			return stats, err
 		}
 
 		w := bufio.NewWriter(f)
@@ -135,7 +249,7 @@ func extractAssetsFromReader(r io.Reader, isZSTD bool, directory string) (err er
 			if n > 0 {
 				if _, err := w.Write(buf[:n]); err != nil {
 					_ = f.Close()
-					return err
+					return stats, err
 				}
 			}
 			if readErr == io.EOF {
@@ -143,17 +257,18 @@ func extractAssetsFromReader(r io.Reader, isZSTD bool, directory string) (err er
 			}
 			if readErr != nil {
 				_ = f.Close()
-				return readErr
+				return stats, readErr
 			}
 		}
 
 		if err := w.Flush(); err != nil {
 			_ = f.Close()
-			return err
+			return stats, err
 		}
 		if err := f.Close(); err != nil {
-			return err
+			return stats, err
 		}
+		count()
 
 		_ = os.Chmod(filename, os.FileMode(header.Mode))            // #nosec
 		_ = os.Chtimes(filename, header.AccessTime, header.ModTime) // #nosec
@@ -163,12 +278,25 @@ func extractAssetsFromReader(r io.Reader, isZSTD bool, directory string) (err er
 	if len(postExtraction) > 0 {
 		app.Log(fmt.Sprintf("Setting timestamps for %d extracted directories", len(postExtraction)))
 		for _, d := range postExtraction {
-			_ = os.Chtimes(d.path, d.header.AccessTime, d.header.ModTime) // #nosec
-			_ = os.Chmod(d.path, d.header.FileInfo().Mode().Perm())       // #nosec
+			// when merging, directory timestamps reflect the merge rather than the archive
+			if opts.conflict == "" {
+				_ = os.Chtimes(d.path, d.header.AccessTime, d.header.ModTime) // #nosec
+			}
+			_ = os.Chmod(d.path, d.header.FileInfo().Mode().Perm()) // #nosec
 		}
 	}
 
-	return nil
+	return stats, nil
+}
+
+// withinDirectory returns whether path is directory or within it, after
+// resolving any symlinks of directory itself
+func withinDirectory(path, directory string) bool {
+	if real, err := filepath.EvalSymlinks(directory); err == nil {
+		directory = real
+	}
+
+	return path == directory || strings.HasPrefix(path, directory+string(os.PathSeparator))
 }
 
 // mkdirAll creates all directories and returns an undo function that removes
@@ -221,7 +349,8 @@ func stripTrailingSlash(p string) string {
 }
 
 // Read a directory and write it to the tar writer. Recursive function that writes all sub folders.
-func tarAddDirectory(directory string, tarWriter *tar.Writer, subPath string) error {
+// Files (relative to the top-level directory) are skipped according to the optional filter.
+func tarAddDirectory(directory string, tarWriter *tar.Writer, subPath string, filter *assetsFilter) error {
 	base, err := os.Stat(directory)
 	if err != nil {
 		return err
@@ -242,6 +371,10 @@ func tarAddDirectory(directory string, tarWriter *tar.Writer, subPath string) er
 		// relative path
 		relativeDirName := evalPath[len(subPath):]
 
+		if filter.skipDir(assetsRelativePath(relativeDirName)) {
+			return nil
+		}
+
 		// inherit directory permissions
 		header, err := tar.FileInfoHeader(base, base.Name())
 		if err != nil {
@@ -266,7 +399,7 @@ func tarAddDirectory(directory string, tarWriter *tar.Writer, subPath string) er
 		currentPath := filepath.Join(directory, file.Name())
 		if file.IsDir() {
 			// process contents of directory
-			if err := tarAddDirectory(currentPath, tarWriter, subPath); err != nil {
+			if err := tarAddDirectory(currentPath, tarWriter, subPath, filter); err != nil {
 				return err
 			}
 		} else {
@@ -274,7 +407,7 @@ func tarAddDirectory(directory string, tarWriter *tar.Writer, subPath string) er
 			if err != nil {
 				return err
 			}
-			err = tarAddFile(currentPath, tarWriter, fi, subPath)
+			err = tarAddFile(currentPath, tarWriter, fi, subPath, filter)
 			if err != nil {
 				return err
 			}
@@ -285,7 +418,7 @@ func tarAddDirectory(directory string, tarWriter *tar.Writer, subPath string) er
 }
 
 // Write path without the prefix in subPath to tar writer.
-func tarAddFile(path string, tarWriter *tar.Writer, fileInfo os.FileInfo, subPath string) error {
+func tarAddFile(path string, tarWriter *tar.Writer, fileInfo os.FileInfo, subPath string, filter *assetsFilter) error {
 	file, err := os.Open(filepath.Clean(path))
 	if err != nil {
 		return err
@@ -316,6 +449,10 @@ func tarAddFile(path string, tarWriter *tar.Writer, fileInfo os.FileInfo, subPat
 		return nil
 	}
 
+	if filter.skipFile(assetsRelativePath(evalPath[len(subPath):]), fileInfo.Size()) {
+		return nil
+	}
+
 	header, err := tar.FileInfoHeader(fileInfo, link)
 	if err != nil {
 		return err
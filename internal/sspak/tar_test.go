@@ -85,14 +85,15 @@ func TestTarAddDirectoryAndExtract(t *testing.T) {
 	tarW := tar.NewWriter(gzW)
 
 	app.IgnoreResampled = false
-	require.NoError(t, tarAddDirectory(srcDir, tarW, filepath.Dir(srcDir)))
+	require.NoError(t, tarAddDirectory(srcDir, tarW, filepath.Dir(srcDir), nil))
 	require.NoError(t, tarW.Close())
 	require.NoError(t, gzW.Close())
 	require.NoError(t, f.Close())
 
 	// Extract and verify
 	outDir := t.TempDir()
-	require.NoError(t, extractAssets(tarPath, outDir))
+	_, err = extractAssets(tarPath, outDir, extractOptions{})
+	require.NoError(t, err)
 
 	dirName := filepath.Base(srcDir)
 	assert.DirExists(t, filepath.Join(outDir, dirName))
@@ -117,13 +118,14 @@ func TestExtractAssetsGzip(t *testing.T) {
 	tarW := tar.NewWriter(gzW)
 
 	app.IgnoreResampled = false
-	require.NoError(t, tarAddDirectory(srcDir, tarW, filepath.Dir(srcDir)))
+	require.NoError(t, tarAddDirectory(srcDir, tarW, filepath.Dir(srcDir), nil))
 	require.NoError(t, tarW.Close())
 	require.NoError(t, gzW.Close())
 	require.NoError(t, f.Close())
 
 	outDir := t.TempDir()
-	require.NoError(t, extractAssets(tarPath, outDir))
+	_, err = extractAssets(tarPath, outDir, extractOptions{})
+	require.NoError(t, err)
 
 	dirName := filepath.Base(srcDir)
 	assert.FileExists(t, filepath.Join(outDir, dirName, "image.png"))
@@ -153,7 +155,8 @@ func TestExtractAssetsTarSlipPrevention(t *testing.T) {
 	require.NoError(t, f.Close())
 
 	outDir := t.TempDir()
-	require.NoError(t, extractAssets(tarPath, outDir))
+	_, err = extractAssets(tarPath, outDir, extractOptions{})
+	require.NoError(t, err)
 
 	// The traversal file must NOT have been written above outDir
 	parent := filepath.Dir(outDir)
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/axllent/ssbak/app"
+)
+
+// RunCommand runs a shell command in dir with additional environment variables
+// (KEY=value), logging its combined output in verbose mode. The output is
+// included in the error if the command fails.
+func RunCommand(dir, command string, env []string) error {
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.Command("cmd", "/C", command) // #nosec G204
+	} else {
+		c = exec.Command("sh", "-c", command) // #nosec G204
+	}
+	c.Dir = dir
+	c.Env = append(os.Environ(), env...)
+
+	app.Log(fmt.Sprintf("Running '%s'", command))
+
+	out, err := c.CombinedOutput()
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		app.Log("  " + scanner.Text())
+	}
+
+	if err != nil {
+		output := strings.TrimSpace(string(out))
+		if output != "" && !app.Verbose {
+			return fmt.Errorf("'%s' failed: %s\n%s", command, err.Error(), output)
+		}
+		return fmt.Errorf("'%s' failed: %s", command, err.Error())
+	}
+
+	return nil
+}
+
+// ClearDir removes the contents of a directory, keeping the directory itself
+func ClearDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CheckClearable returns an error if dir must never be emptied by ClearDir:
+// the filesystem root, the system temporary directory, the user's home
+// directory, or webroot or any of its parent directories
+func CheckClearable(dir, webroot string) error {
+	real := func(p string) string {
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+		if r, err := filepath.EvalSymlinks(p); err == nil {
+			p = r
+		}
+		return p
+	}
+
+	d := real(dir)
+
+	if d == filepath.Dir(d) {
+		return fmt.Errorf("'%s' is the filesystem root", dir)
+	}
+
+	if d == real(os.TempDir()) {
+		return fmt.Errorf("'%s' is the system temporary directory", dir)
+	}
+
+	if home, err := os.UserHomeDir(); err == nil && d == real(home) {
+		return fmt.Errorf("'%s' is the home directory", dir)
+	}
+
+	w := real(webroot)
+	if w == d || strings.HasPrefix(w, d+string(os.PathSeparator)) {
+		return fmt.Errorf("'%s' contains the webroot", dir)
+	}
+
+	return nil
+}
@@ -2,8 +2,11 @@ package utils
 
 import (
 	"fmt"
+	"math"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/axllent/ssbak/app"
 )
@@ -67,3 +70,25 @@ func ByteToHr(b int64) string {
 	return fmt.Sprintf("%.1f%ciB",
 		float64(b)/float64(div), "KMGTPE"[exp])
 }
+
+// ParseSize returns the number of bytes of a human readable size, eg: 500M, 1.5GB or 1024.
+// Units are binary (1K = 1024 bytes).
+func ParseSize(size string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(size))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "B"), "I")
+
+	multiplier := 1.0
+	if v != "" {
+		if exp := strings.IndexByte("KMGTPE", v[len(v)-1]); exp >= 0 {
+			multiplier = math.Pow(1024, float64(exp+1))
+			v = v[:len(v)-1]
+		}
+	}
+
+	n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", size)
+	}
+
+	return int64(n * multiplier), nil
+}
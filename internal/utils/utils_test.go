@@ -3,6 +3,7 @@ package utils_test
 import (
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/axllent/ssbak/internal/utils"
@@ -95,3 +96,87 @@ func TestByteToHr(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0", 0},
+		{"1024", 1024},
+		{"1K", 1024},
+		{"1.5KB", 1536},
+		{"500M", 524288000},
+		{"500mb", 524288000},
+		{"2GiB", 2147483648},
+		{"1T", 1099511627776},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			size, err := utils.ParseSize(tt.input)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, size)
+		})
+	}
+
+	for _, invalid := range []string{"", "M", "-1", "10X"} {
+		_, err := utils.ParseSize(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestClearDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "a.txt"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644))
+
+	require.NoError(t, utils.ClearDir(dir))
+
+	assert.True(t, utils.IsDir(dir))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	assert.Error(t, utils.ClearDir(filepath.Join(dir, "nonexistent")))
+}
+
+func TestRunCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	require.NoError(t, utils.RunCommand(dir, `echo "$SSBAK_TEST" > out.txt`, []string{"SSBAK_TEST=hello"}))
+
+	b, err := os.ReadFile(filepath.Join(dir, "out.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hello\n", string(b))
+
+	err = utils.RunCommand(dir, "echo oops; exit 3", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "oops")
+}
+
+func TestCheckClearable(t *testing.T) {
+	webroot := filepath.Join(t.TempDir(), "site", "public")
+	require.NoError(t, os.MkdirAll(filepath.Join(webroot, "silverstripe-cache"), 0755))
+
+	assert.NoError(t, utils.CheckClearable(filepath.Join(webroot, "silverstripe-cache"), webroot))
+	assert.NoError(t, utils.CheckClearable(filepath.Join(t.TempDir(), "cache"), webroot))
+
+	home, err := os.UserHomeDir()
+	require.NoError(t, err)
+
+	for _, dir := range []string{
+		string(filepath.Separator),
+		os.TempDir(),
+		home,
+		webroot,
+		filepath.Dir(webroot),
+		filepath.Dir(filepath.Dir(webroot)),
+	} {
+		assert.Error(t, utils.CheckClearable(dir, webroot), "expected '%s' to be refused", dir)
+	}
+}